@@ -0,0 +1,265 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	entity "rob.co/textcrawl/entity"
+)
+
+// Stat allocation during character creation. Every stat starts at statBase and
+// the player spreads statPoints between them, up to statMax in any one.
+const (
+	statBase   = 8
+	statMax    = 18
+	statPoints = 20
+)
+
+// Limits on a new character's name and description
+const (
+	minCharNameLength = 3
+	maxCharNameLength = 20
+	maxCharDescLength = 300
+)
+
+// The stats, in the order they're stored in Stats (and the DB)
+var statNames = []string{"str", "dex", "int", "will", "health", "mind"}
+
+// A characterDraft is a character the player is in the middle of creating.
+type characterDraft struct {
+	name  string
+	desc  string
+	stats [6]int // in the order of statNames
+}
+
+func newCharacterDraft() *characterDraft {
+	d := &characterDraft{}
+	d.reset()
+	return d
+}
+
+// reset Put all the points back.
+func (d *characterDraft) reset() {
+	for i := range d.stats {
+		d.stats[i] = statBase
+	}
+}
+
+// pointsLeft How many points haven't been spent yet.
+func (d *characterDraft) pointsLeft() int {
+	left := statPoints
+	for _, v := range d.stats {
+		left -= v - statBase
+	}
+	return left
+}
+
+// add Spend n points on the stat (or take them back, if n is negative).
+// The stat can be abbreviated. Spending is limited by the points left and the stat's range.
+func (d *characterDraft) add(stat string, n int) error {
+	i := -1
+	stat = strings.ToLower(stat)
+	for j, name := range statNames {
+		if stat != "" && strings.HasPrefix(name, stat) {
+			i = j
+			break
+		}
+	}
+	if i < 0 {
+		return fmt.Errorf("There's no stat called '%s'", stat)
+	}
+	v := d.stats[i] + n
+	switch {
+	case n > d.pointsLeft():
+		return fmt.Errorf("You only have %d points left", d.pointsLeft())
+	case v > statMax:
+		return fmt.Errorf("%s can't go above %d", capitalise(statNames[i]), statMax)
+	case v < statBase:
+		return fmt.Errorf("%s can't go below %d", capitalise(statNames[i]), statBase)
+	}
+	d.stats[i] = v
+	return nil
+}
+
+// describe Show the stats as they stand.
+func (d *characterDraft) describe() string {
+	parts := make([]string, 0, len(statNames))
+	for i, name := range statNames {
+		parts = append(parts, fmt.Sprintf("%s %d", capitalise(name), d.stats[i]))
+	}
+	return fmt.Sprintf("  %s  (%d points left)\n", strings.Join(parts, "  "), d.pointsLeft())
+}
+
+// entityStats The stats in the form an Actor keeps them.
+func (d *characterDraft) entityStats() entity.Stats {
+	attribs := make([]entity.Attrib, len(d.stats))
+	for i, v := range d.stats {
+		attribs[i] = entity.Attrib{Real: v, Cur: v}
+	}
+	return entity.Stats{
+		Str:    attribs[0],
+		Dex:    attribs[1],
+		Int:    attribs[2],
+		Will:   attribs[3],
+		Health: attribs[4],
+		Mind:   attribs[5],
+	}
+}
+
+// characterName Check a name for a new character is the right length and all
+// letters, returning it capitalised.
+func characterName(text string) (string, error) {
+	name := strings.TrimSpace(text)
+	if len(name) < minCharNameLength || len(name) > maxCharNameLength {
+		return "", fmt.Errorf("Names must be between %d and %d letters long", minCharNameLength, maxCharNameLength)
+	}
+	for _, r := range name {
+		if (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') {
+			return "", errors.New("Names can only have letters in them")
+		}
+	}
+	return capitalise(strings.ToLower(name)), nil
+}
+
+// capitalise Upper case the first letter of an ASCII word.
+func capitalise(word string) string {
+	if word == "" {
+		return word
+	}
+	return strings.ToUpper(word[:1]) + word[1:]
+}
+
+// startCharacter Begin creating a character for a player who doesn't have one.
+func (s *Server) startCharacter(sess *Session, req Request) entity.Player {
+	sess.draft = newCharacterDraft()
+	req.Write("\nLet's make you a character. What would you like to be called? ")
+	req.Player.LoginState = entity.LoginStateCharName
+	return req.Player
+}
+
+// doCharacter Take the player through creating a character, a step at a time.
+func (s *Server) doCharacter(sess *Session, req Request) entity.Player {
+	text := strings.TrimSpace(req.Text)
+	d := sess.draft
+	switch req.Player.LoginState {
+	case entity.LoginStateCharName:
+		name, err := characterName(text)
+		if err != nil {
+			req.Write(err.Error() + ". What would you like to be called? ")
+			break
+		}
+		d.name = name
+		req.Write(fmt.Sprintf("Describe %s as others will see them: ", name))
+		req.Player.LoginState = entity.LoginStateCharDesc
+	case entity.LoginStateCharDesc:
+		if text == "" {
+			req.Write(fmt.Sprintf("Describe %s as others will see them: ", d.name))
+			break
+		}
+		if len(text) > maxCharDescLength {
+			req.Write(fmt.Sprintf("Please keep it under %d characters. Describe %s as others will see them: ",
+				maxCharDescLength, d.name))
+			break
+		}
+		d.desc = text
+		req.Write(fmt.Sprintf("\nYou have %d points to spend on your stats. Each starts at %d and can go up to %d.\n",
+			statPoints, statBase, statMax))
+		req.Write(d.describe())
+		req.Write("Type a stat and a number of points to add to it (e.g. \"str 4\"), \"reset\" to start over, " +
+			"or \"done\" when you're finished.\n> ")
+		req.Player.LoginState = entity.LoginStateCharStats
+	case entity.LoginStateCharStats:
+		words := strings.Fields(strings.ToLower(text))
+		switch {
+		case len(words) == 0:
+			req.Write(d.describe())
+		case words[0] == "reset":
+			d.reset()
+			req.Write(d.describe())
+		case words[0] == "done":
+			if d.pointsLeft() > 0 {
+				req.Write(fmt.Sprintf("You still have %d points to spend.\n", d.pointsLeft()))
+				break
+			}
+			return s.finishCharacter(sess, req)
+		case len(words) == 2:
+			n, err := strconv.Atoi(words[1])
+			if err == nil {
+				err = d.add(words[0], n)
+			}
+			if err != nil {
+				req.Write(err.Error() + ".\n")
+			}
+			req.Write(d.describe())
+		default:
+			req.Write("Type a stat and a number (e.g. \"dex 3\"), \"reset\" or \"done\".\n")
+		}
+		req.Write("> ")
+	}
+	return req.Player
+}
+
+// finishCharacter Have the engine put the new character in the world, and log the player in as them.
+func (s *Server) finishCharacter(sess *Session, req Request) entity.Player {
+	d := sess.draft
+	result := make(chan characterResult, 1)
+	msg := NewMessage(CreateCharacter, req.Player, req.Writer)
+	msg.character = &characterRequest{username: req.Player.Username, draft: *d, result: result}
+	s.msgChan <- msg
+	res := <-result
+	if res.err != nil {
+		log.Printf("WARN: unable to create character %s for %s: %s", d.name, req.Player.Username, res.err)
+		req.Write("Something went wrong creating your character. Please try again later.\n")
+		_ = sess.sender.Close()
+		return req.Player
+	}
+	log.Printf("INFO: %s created character %s (%s)", req.Player.Username, d.name, res.actorId)
+	sess.draft = nil
+	req.Write(fmt.Sprintf("Welcome to the world, %s!\n", d.name))
+	req.Player.ActorId = res.actorId
+	req.Player.LoginState = entity.LoginStateLoggedIn
+	return req.Player
+}
+
+// A characterRequest asks the engine to bring a newly created character into the world.
+type characterRequest struct {
+	username string
+	draft    characterDraft
+	result   chan characterResult
+}
+
+type characterResult struct {
+	actorId entity.Id
+	err     error
+}
+
+// createCharacter Make the actor for a new character in the starting room, and give
+// it to the player. If the player can't have it, it's deleted again.
+func (e *Engine) createCharacter(req *characterRequest) {
+	zone, err := e.zoneMgr.GetZone(entity.Id(e.config.StartZone))
+	if err != nil {
+		req.result <- characterResult{err: err}
+		return
+	}
+	room := zone.GetRoom(entity.Id("R" + e.config.StartRoom))
+	if room == nil {
+		req.result <- characterResult{err: fmt.Errorf("no start room %s in zone %s", e.config.StartRoom, zone.Id)}
+		return
+	}
+	actor, err := e.zoneMgr.CreateActor(zone, req.draft.name, req.draft.desc, req.draft.entityStats(), room)
+	if err != nil {
+		req.result <- characterResult{err: err}
+		return
+	}
+	if err := e.playerMgr.SetActor(req.username, actor.Id); err != nil {
+		if delErr := zone.DeleteActor(actor); delErr != nil {
+			log.Printf("ERROR: unable to delete unused actor %s: %s", actor.Id, delErr)
+		}
+		req.result <- characterResult{err: err}
+		return
+	}
+	req.result <- characterResult{actorId: actor.Id}
+}
@@ -0,0 +1,45 @@
+package main
+
+import "testing"
+
+func TestCharacterDraft(t *testing.T) {
+	d := newCharacterDraft()
+	if d.pointsLeft() != statPoints {
+		t.Fatalf("Expected a new draft to have %d points, got %d", statPoints, d.pointsLeft())
+	}
+	if err := d.add("st", 4); err != nil {
+		t.Errorf("Expected to be able to add to str by abbreviation, got: %s", err)
+	}
+	if err := d.add("dex", statMax-statBase+1); err == nil {
+		t.Error("Expected a stat not to go past the maximum")
+	}
+	if err := d.add("mind", -1); err == nil {
+		t.Error("Expected a stat not to go below the base")
+	}
+	if err := d.add("luck", 1); err == nil {
+		t.Error("Expected an unknown stat to be rejected")
+	}
+	if err := d.add("health", statPoints); err == nil {
+		t.Error("Expected not to be able to spend more points than are left")
+	}
+	stats := d.entityStats()
+	if stats.Str.Real != statBase+4 || stats.Str.Cur != statBase+4 || stats.Dex.Real != statBase {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+	d.reset()
+	if d.pointsLeft() != statPoints {
+		t.Errorf("Expected reset to return all the points, but %d are left", d.pointsLeft())
+	}
+}
+
+func TestCharacterName(t *testing.T) {
+	name, err := characterName(" aLiCe ")
+	if err != nil || name != "Alice" {
+		t.Errorf("Expected 'Alice', got '%s' (%v)", name, err)
+	}
+	for _, bad := range []string{"Al", "Mary Jane", "R2D2", "averyveryverylongname"} {
+		if _, err := characterName(bad); err == nil {
+			t.Errorf("Expected '%s' to be rejected", bad)
+		}
+	}
+}
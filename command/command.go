@@ -1,19 +1,31 @@
 package command
 
 import (
+	"errors"
+	"fmt"
 	"io"
 	"log"
 	entity "rob.co/textcrawl/entity"
+	"strconv"
 	"strings"
 )
 
 type Noun struct {
-	Text string
-	Ref  any
+	Text       string
+	Ref        any
+	Candidates []any // what Text could mean, if it could mean several things. Ref is nil until the player picks one
+	Several    bool  // whether it's one of several things, as in "all", "all.knife" or "3 coins"
+	start      int   // where Text starts in the command's words
 }
 
 func NewNoun(text string, ref any) Noun {
-	return Noun{text, ref}
+	return Noun{Text: text, Ref: ref}
+}
+
+// Thing What the noun refers to, if it's a thing rather than a person.
+func (n Noun) Thing() *entity.Thing {
+	thing, _ := n.Ref.(*entity.Thing)
+	return thing
 }
 
 type Command struct {
@@ -25,34 +37,26 @@ type Command struct {
 	IndirectObjs []Noun
 	Actor        *entity.Actor
 	Room         *entity.Room
+	Spec         *Spec         // the registered command, if there is one
+	Candidates   []*Spec       // the commands an ambiguous abbreviation could be
+	within       *entity.Thing // where to look for the direct objects, if they're in a container
 }
 
 type Action func(cmd Command, writer io.Writer) (bool, error)
 
-var dispatchTable = map[string][]Action{
-	"goDirection": {goDirection},
-}
-
-var translations = map[string][]string{
-	"s":         {"goDirection", "south"},
-	"south":     {"goDirection", "south"},
-	"n":         {"goDirection", "north"},
-	"north":     {"goDirection", "north"},
-	"e":         {"goDirection", "east"},
-	"east":      {"goDirection", "east"},
-	"w":         {"goDirection", "west"},
-	"west":      {"goDirection", "west"},
-	"nw":        {"goDirection", "northwest"},
-	"northwest": {"goDirection", "northwest"},
-	"ne":        {"goDirection", "northeast"},
-	"northeast": {"goDirection", "northeast"},
-	"sw":        {"goDirection", "southwest"},
-	"southwest": {"goDirection", "southwest"},
-	"se":        {"goDirection", "southeast"},
-	"southeast": {"goDirection", "southeast"},
-	"l":         {"look"},
-	"i":         {"inventory"},
-	"inv":       {"inventory"},
+// Ordinals players can use to pick one of several things with the same name, as
+// in "take second knife". "take 2.knife" works too.
+var ordinals = map[string]int{
+	"first":   1,
+	"second":  2,
+	"third":   3,
+	"fourth":  4,
+	"fifth":   5,
+	"sixth":   6,
+	"seventh": 7,
+	"eighth":  8,
+	"ninth":   9,
+	"tenth":   10,
 }
 
 var prepositions = []string{
@@ -90,60 +94,415 @@ func NewCommand(text string, actor *entity.Actor, room *entity.Room) Command {
 	return cmd
 }
 
-// look for abbreviations and other mappings
+// TranslateAction Work out the action and any params the verb stands for, by
+// looking it up in the registry. Unregistered verbs are their own action,
+// though Perform won't run them.
 func TranslateAction(text string) (string, []string) {
-	t := translations[text]
-	if t == nil {
-		t = []string{text}
+	return translate(Lookup(text), text)
+}
+
+func translate(spec *Spec, text string) (string, []string) {
+	if spec == nil {
+		return text, []string{}
 	}
-	return t[0], t[1:]
+	return spec.action(), append([]string{}, spec.Args...)
+}
+
+// Words The words of the command after the verb, exactly as typed.
+// Useful for commands whose arguments aren't objects in the world.
+func (c *Command) Words() []string {
+	words := strings.Fields(c.Text)
+	if len(words) == 0 {
+		return words
+	}
+	return words[1:]
 }
 
 func (c *Command) resolveWords() {
-	words := strings.Split(c.Text, " ")
-	c.Action, c.Params = TranslateAction(words[0])
-words:
-	for _, w := range words[1:] {
-		entity := c.Room.Find(w)
-		// if not in room, check actor's inventory
-		if entity == nil {
-			entity = c.Actor.Find(w)
+	words := strings.Fields(c.Text)
+	if len(words) == 0 {
+		return
+	}
+	c.Spec, c.Candidates = Resolve(words[0], c.Actor)
+	c.Action, c.Params = translate(c.Spec, words[0])
+	at := c.readNouns(words)
+	// "take knife from bucket": the knife is in the bucket, so look for it there
+	if c.Preposition == "from" && len(c.IndirectObjs) == 1 {
+		if container := c.IndirectObjs[0].Thing(); container != nil {
+			c.within = container
+			c.Preposition = ""
+			c.DirectObjs = make([]Noun, 0)
+			c.readNouns(words[:at])
+			c.Preposition = "from"
+			c.within = nil
 		}
+	}
+}
+
+// readNouns Sort the words after the verb into direct objects, a preposition
+// and indirect objects. Returns where the preposition was.
+func (c *Command) readNouns(words []string) int {
+	at := len(words)
+	for i := 1; i < len(words); {
 		// if not a noun, maybe a preposition?
-		if entity == nil && c.Preposition == "" && len(c.DirectObjs) > 0 {
-			for _, p := range prepositions {
-				if w == p {
-					c.Preposition = p
-					continue words
-				}
-			}
+		if c.Preposition == "" && isPreposition(words[i]) && len(c.find(words[i:i+1])) == 0 {
+			c.Preposition = words[i]
+			at = i
+			i++
+			continue
+		}
+		if entity.IsArticle(words[i]) {
+			i++
+			continue
 		}
 		// TODO: we don't know what this thing is...add special 'unknown' object?
-		// if entity == nil {
-		// }
+		var nouns []Noun
+		nouns, i = c.phrase(words, i)
 		if c.Preposition == "" {
-			c.DirectObjs = append(c.DirectObjs, NewNoun(w, entity))
+			c.DirectObjs = append(c.DirectObjs, nouns...)
 		} else {
-			c.IndirectObjs = append(c.IndirectObjs, NewNoun(w, entity))
+			c.IndirectObjs = append(c.IndirectObjs, nouns...)
 		}
 	}
+	return at
 }
 
-func Perform(cmd Command, writer io.Writer) {
+// phrase Read the noun starting at words[i], returning what it refers to and
+// where the next one starts. A noun is an optional ordinal or count, followed by
+// as many words as still match something, so "rusty bucket" is one noun but
+// "knife bucket" is two. "all", "all.knife" and "3 coins" are several things at
+// once, so they come back as one Noun each.
+func (c *Command) phrase(words []string, i int) ([]Noun, int) {
+	start := i
+	n, first := splitOrdinal(words[i])
+	count := 0 // how many things the player wants; -1 means all of them
+	lower := strings.ToLower(first)
+	switch {
+	case lower == "all":
+		return several(c.everything(), "all", start), i + 1
+	case strings.HasPrefix(lower, "all.") && len(first) > len("all."):
+		count = -1
+		first = first[len("all."):]
+	case n == 0 && ordinals[lower] > 0 && i+1 < len(words):
+		n = ordinals[lower]
+		i++
+		first = words[i]
+	case n == 0 && isCount(first) && i+1 < len(words):
+		count, _ = strconv.Atoi(first)
+		i++
+		first = words[i]
+	}
+	phrase := []string{first}
+	found := c.find(phrase)
+	end := i + 1
+	for len(found) > 0 && end < len(words) && !isPreposition(words[end]) {
+		more := c.find(append(append([]string{}, phrase...), words[end]))
+		if len(more) == 0 {
+			break
+		}
+		phrase = append(phrase, words[end])
+		found = more
+		end++
+	}
+	noun := Noun{Text: strings.Join(words[start:end], " "), start: start}
+	switch {
+	case count != 0:
+		found = onlyThings(found)
+		if count > 0 && count < len(found) {
+			found = found[:count]
+		}
+		return several(found, noun.Text, start), end
+	case n > 0:
+		if n <= len(found) {
+			noun.Ref = found[n-1]
+		}
+	case len(found) == 1 || sameTitles(found):
+		noun.Ref = found[0]
+	case len(found) > 1:
+		noun.Candidates = found
+	}
+	return []Noun{noun}, end
+}
+
+// several One noun for each thing found, all with the text that found them.
+// If nothing was found, there's still a noun, so the handler can say so.
+func several(found []any, text string, start int) []Noun {
+	if len(found) == 0 {
+		return []Noun{{Text: text, Several: true, start: start}}
+	}
+	nouns := make([]Noun, 0, len(found))
+	for _, ref := range found {
+		nouns = append(nouns, Noun{Text: text, Ref: ref, Several: true, start: start})
+	}
+	return nouns
+}
+
+// scope Where to look for the next noun. Only the direct objects are limited
+// to the command's scope: "put knife in bucket" can find the bucket anywhere.
+func (c *Command) scope() Scope {
+	if c.Spec == nil || c.Preposition != "" {
+		return ScopeAnywhere
+	}
+	return c.Spec.Scope
+}
+
+// find Everything the words could refer to in the room or, failing that, what
+// the actor has, as far as the command's scope allows. If the command names a
+// container, it's only what's in that. Things nobody can see aren't found.
+func (c *Command) find(words []string) []any {
+	var found []any
+	if c.within != nil {
+		for _, thing := range c.within.FindAll(words) {
+			found = append(found, thing)
+		}
+		return visible(found)
+	}
+	scope := c.scope()
+	if scope == ScopeAnywhere || scope == ScopeRoom {
+		found = visible(c.Room.FindAll(words))
+	}
+	if len(found) == 0 && scope != ScopeRoom {
+		for _, thing := range entity.FindAmong(c.held(), words) {
+			found = append(found, thing)
+		}
+	}
+	return found
+}
+
+// everything What "all" means: the things in the room or, failing that, what
+// the actor has, as far as the command's scope allows. Never people, nor
+// things nobody can see.
+func (c *Command) everything() []any {
+	var found []any
+	if c.within != nil {
+		for _, thing := range c.within.Contents {
+			found = append(found, thing)
+		}
+		return visible(found)
+	}
+	scope := c.scope()
+	if scope == ScopeAnywhere || scope == ScopeRoom {
+		for _, thing := range c.Room.Things {
+			found = append(found, thing)
+		}
+		found = visible(found)
+	}
+	if len(found) == 0 && scope != ScopeRoom {
+		for _, thing := range c.held() {
+			found = append(found, thing)
+		}
+	}
+	return found
+}
+
+// held What the actor has that the command's scope covers: what it's carrying,
+// what it's wearing and wielding, or both.
+func (c *Command) held() []*entity.Thing {
+	switch c.scope() {
+	case ScopeInventory:
+		return c.Actor.Carrying()
+	case ScopeEquipment:
+		return c.Actor.Equipment()
+	}
+	return c.Actor.Body.Contents
+}
+
+// visible Leave out the hidden and invisible things.
+func visible(found []any) []any {
+	seen := []any{}
+	for _, ref := range found {
+		if thing, ok := ref.(*entity.Thing); !ok || thing.Visible() {
+			seen = append(seen, ref)
+		}
+	}
+	return seen
+}
+
+// onlyThings Leave the actors out of what was found.
+func onlyThings(found []any) []any {
+	things := []any{}
+	for _, ref := range found {
+		if _, ok := ref.(*entity.Thing); ok {
+			things = append(things, ref)
+		}
+	}
+	return things
+}
+
+// isCount Whether word is a number of things, as in "take 3 coins".
+func isCount(word string) bool {
+	n, err := strconv.Atoi(word)
+	return err == nil && n > 0
+}
+
+// splitOrdinal Split "2.knife" into 2 and "knife". Words without a number are returned as they are.
+func splitOrdinal(word string) (int, string) {
+	i := strings.Index(word, ".")
+	if i <= 0 || i == len(word)-1 {
+		return 0, word
+	}
+	n, err := strconv.Atoi(word[:i])
+	if err != nil || n <= 0 {
+		return 0, word
+	}
+	return n, word[i+1:]
+}
+
+func isPreposition(word string) bool {
+	for _, p := range prepositions {
+		if word == p {
+			return true
+		}
+	}
+	return false
+}
+
+// sameTitles Whether everything found looks the same, so there's no point
+// asking which one the player meant.
+func sameTitles(found []any) bool {
+	if len(found) == 0 {
+		return false
+	}
+	for _, ref := range found[1:] {
+		if titleOf(ref) != titleOf(found[0]) {
+			return false
+		}
+	}
+	return true
+}
+
+// A matcher is anything players can refer to by name.
+type matcher interface {
+	MatchWords(words []string) entity.MatchLevel
+}
+
+func titleOf(ref any) string {
+	switch r := ref.(type) {
+	case *entity.Actor:
+		return r.GetTitle()
+	case *entity.Thing:
+		return r.Title
+	}
+	return ""
+}
+
+// Unclear The first noun which could mean more than one thing, if any.
+func (c *Command) Unclear() *Noun {
+	for _, nouns := range [][]Noun{c.DirectObjs, c.IndirectObjs} {
+		for i := range nouns {
+			if len(nouns[i].Candidates) > 0 {
+				return &nouns[i]
+			}
+		}
+	}
+	return nil
+}
+
+// Clarify Work out which of the unclear noun's candidates the player meant by
+// answer: its number in the list, an ordinal, or words which match only one of
+// them. Returns the command's text with the choice spelled out, ready to run again.
+func (c *Command) Clarify(answer string) (string, bool) {
+	noun := c.Unclear()
+	words := strings.Fields(answer)
+	if noun == nil || len(words) == 0 {
+		return "", false
+	}
+	choice := 0
+	if n, err := strconv.Atoi(strings.TrimRight(words[0], ".)")); err == nil && len(words) == 1 {
+		choice = n
+	} else if n := ordinals[strings.ToLower(words[0])]; n > 0 && len(words) == 1 {
+		choice = n
+	} else {
+		for i, ref := range noun.Candidates {
+			m, ok := ref.(matcher)
+			if !ok || m.MatchWords(words) == entity.MatchNone {
+				continue
+			}
+			if choice > 0 {
+				return "", false
+			}
+			choice = i + 1
+		}
+	}
+	if choice < 1 || choice > len(noun.Candidates) {
+		return "", false
+	}
+	text := strings.Fields(c.Text)
+	text[noun.start] = fmt.Sprintf("%d.%s", choice, text[noun.start])
+	return strings.Join(text, " "), true
+}
+
+// Perform Run the command. A registered Go handler gets first crack at it; if
+// there isn't one, or it doesn't finish the job, we fall back to the Lua function
+// named by the action.
+func Perform(cmd Command, writer io.Writer, scripts *Scripts) {
 	// basically means blank line
 	if cmd.Action == "" {
 		return
 	}
-	handlers := dispatchTable[cmd.Action]
-	for _, h := range handlers {
-		done, err := h(cmd, writer)
-		if done {
-			break
+	if len(cmd.Candidates) > 0 {
+		_, _ = fmt.Fprintf(writer, "'%s' could be %s. Which did you mean?\n", cmd.Action, orList(names(cmd.Candidates)))
+		return
+	}
+	// Only registered commands are run. Otherwise typing the name of any Lua
+	// function would call it, whoever it's meant for.
+	if cmd.Spec == nil {
+		_, _ = writer.Write([]byte("Huh?\n"))
+		return
+	}
+	if !cmd.Spec.Allows(cmd.Actor) {
+		log.Printf("INFO: %s (%s) was refused '%s'", cmd.Actor.Player.Username, cmd.Actor.Player.Role, cmd.Action)
+		_, _ = writer.Write([]byte("You aren't allowed to do that.\n"))
+		return
+	}
+	if noun := cmd.Unclear(); noun != nil {
+		_, _ = fmt.Fprintf(writer, "Which %s did you mean?\n", noun.Text)
+		for i, ref := range noun.Candidates {
+			_, _ = fmt.Fprintf(writer, "  %d) %s\n", i+1, titleOf(ref))
 		}
+		return
+	}
+	handled := cmd.Spec.Handler != nil
+	if handled {
+		done, err := cmd.Spec.Handler(cmd, writer)
 		if err != nil {
 			log.Printf("%s", err)
-			// TODO: break?
 		}
+		if done {
+			return
+		}
+	}
+	if scripts == nil {
+		return
+	}
+	found, err := scripts.Call(cmd, writer)
+	if err != nil {
+		log.Printf("WARN: %s", err)
+		if errors.Is(err, ErrScriptTimeout) {
+			_, _ = writer.Write([]byte("That took too long, so we gave up on it.\n"))
+		} else {
+			_, _ = writer.Write([]byte("Something went wrong.\n"))
+		}
+		return
+	}
+	if !found && !handled {
+		_, _ = writer.Write([]byte("Huh?\n"))
 	}
+}
 
+// names The names of the commands.
+func names(specs []*Spec) []string {
+	words := make([]string, 0, len(specs))
+	for _, s := range specs {
+		words = append(words, s.Name)
+	}
+	return words
+}
+
+// orList Join words into "a, b or c".
+func orList(words []string) string {
+	if len(words) < 2 {
+		return strings.Join(words, "")
+	}
+	return strings.Join(words[:len(words)-1], ", ") + " or " + words[len(words)-1]
 }
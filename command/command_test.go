@@ -1,6 +1,11 @@
 package command
 
 import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 	"testing"
 	entity "rob.co/textcrawl/entity"
 
@@ -11,6 +16,7 @@ func DoCommand(text string) Command {
 	zm, _ := entity.GetZoneMgr()
 	zone, _ := zm.GetZone("1")
 	room := zone.Rooms["R1"]
+	a.Zone = zone
 	room.InsertActor(a)
 	cmd := NewCommand(text, a, room)
 	return cmd
@@ -91,3 +97,298 @@ func TestNewCommand(t *testing.T) {
 	}
 
 }
+
+func TestPerformScripted(t *testing.T) {
+	scripts, err := LoadScripts("../lib/commands.lua")
+	if err != nil {
+		t.Fatalf("Unable to load scripts: %s", err)
+	}
+	defer scripts.Close()
+
+	var out bytes.Buffer
+	Perform(DoCommand("look"), &out, scripts)
+	if !strings.Contains(out.String(), "This is an empty room") {
+		t.Errorf("Expected look to describe the room but got '%s'", out.String())
+	}
+
+	out.Reset()
+	Perform(DoCommand("frobnicate"), &out, scripts)
+	if out.String() != "Huh?\n" {
+		t.Errorf("Expected unknown command to get 'Huh?' but got '%s'", out.String())
+	}
+}
+
+func TestLoadScriptsRejectsBadFiles(t *testing.T) {
+	dir := t.TempDir()
+	broken := filepath.Join(dir, "broken.lua")
+	os.WriteFile(broken, []byte("function look(req)\n req:Write("), 0644)
+	if _, err := LoadScripts(broken); err == nil {
+		t.Error("Expected a syntax error to be reported")
+	}
+	empty := filepath.Join(dir, "empty.lua")
+	os.WriteFile(empty, []byte("x = 1\n"), 0644)
+	if _, err := LoadScripts(empty); err == nil {
+		t.Error("Expected a file with no functions to be rejected")
+	}
+}
+
+func TestPerformChecksPermissions(t *testing.T) {
+	scripts := loadTestScripts(t, `
+function secret(req) req:Write("the secret") end
+function whoami(req)
+	if req:HasRole("builder") then req:Write("a builder") else req:Write(req:Role()) end
+end
+`)
+	Register(Spec{Name: "secret", Role: entity.RoleAdmin})
+	defer Unregister("secret")
+	Register(Spec{Name: "whoami"})
+	defer Unregister("whoami")
+
+	var out bytes.Buffer
+	c := DoCommand("secret")
+	Perform(c, &out, scripts)
+	if strings.Contains(out.String(), "the secret") {
+		t.Errorf("Expected a player to be refused, got '%s'", out.String())
+	}
+	Perform(DoCommand("whoami"), &out, scripts)
+	if !strings.HasSuffix(out.String(), "player") {
+		t.Errorf("Expected the script to see the player's role, got '%s'", out.String())
+	}
+
+	out.Reset()
+	c.Actor.Player.Role = entity.RoleOwner
+	Perform(c, &out, scripts)
+	if out.String() != "the secret" {
+		t.Errorf("Expected an owner to be allowed, got '%s'", out.String())
+	}
+	c.Actor.Player.Role = entity.RoleBuilder
+	out.Reset()
+	c = NewCommand("whoami", c.Actor, c.Room)
+	Perform(c, &out, scripts)
+	if out.String() != "a builder" {
+		t.Errorf("Expected HasRole to pass for a builder, got '%s'", out.String())
+	}
+}
+
+func TestDisambiguation(t *testing.T) {
+	Register(Spec{Name: "take"})
+	defer Unregister("take")
+
+	c := DoCommand("look")
+	silver := &entity.Thing{Id: "T90", Title: "a silver knife"}
+	c.Room.Insert(silver)
+	redo := func(text string) Command {
+		return NewCommand(text, c.Actor, c.Room)
+	}
+
+	c = redo("take knife")
+	noun := c.Unclear()
+	if noun == nil || len(noun.Candidates) != 2 || noun.Ref != nil {
+		t.Fatalf("Expected 'knife' to be unclear, got %+v", c.DirectObjs)
+	}
+	var out bytes.Buffer
+	Perform(c, &out, nil)
+	if out.String() != "Which knife did you mean?\n  1) tin knife\n  2) a silver knife\n" {
+		t.Errorf("Expected to be asked which knife, got '%s'", out.String())
+	}
+	for _, answer := range []string{"2", "second", "silver"} {
+		text, ok := c.Clarify(answer)
+		if !ok || text != "take 2.knife" {
+			t.Errorf("Expected '%s' to pick the second knife, got '%s'", answer, text)
+		}
+	}
+	if _, ok := c.Clarify("look"); ok {
+		t.Error("Expected an answer matching neither to be taken as a new command")
+	}
+
+	for text, want := range map[string]entity.Id{
+		"take 2.knife":        "T90",
+		"take second knife":   "T90",
+		"take silver":         "T90",
+		"take tin knife":      "T1",
+		"take 1.knife":        "T1",
+		"take rusty bucket":   "T3",
+		"take old pail":       "T3",
+		"take the rusty pail": "T3",
+	} {
+		c = redo(text)
+		if len(c.DirectObjs) != 1 {
+			t.Errorf("Expected '%s' to have 1 direct object, got %+v", text, c.DirectObjs)
+			continue
+		}
+		if thing, ok := c.DirectObjs[0].Ref.(*entity.Thing); !ok || thing.ID() != want {
+			t.Errorf("Expected '%s' to take %s, got %+v", text, want, c.DirectObjs[0])
+		}
+	}
+
+	c = redo("take 3.knife")
+	if c.DirectObjs[0].Ref != nil || c.DirectObjs[0].Text != "3.knife" {
+		t.Errorf("Expected there to be no third knife, got %+v", c.DirectObjs[0])
+	}
+
+	// two knives that look the same aren't worth asking about
+	c.Room.Remove(silver)
+	c.Room.Insert(&entity.Thing{Id: "T91", Title: "tin knife"})
+	c = redo("take knife")
+	if c.Unclear() != nil || c.DirectObjs[0].Ref.(*entity.Thing).ID() != "T1" {
+		t.Errorf("Expected the first of two identical knives, got %+v", c.DirectObjs[0])
+	}
+	c = redo("take 2.knife")
+	if c.DirectObjs[0].Ref.(*entity.Thing).ID() != "T91" {
+		t.Errorf("Expected the second of two identical knives, got %+v", c.DirectObjs[0])
+	}
+}
+
+func TestSeveralObjects(t *testing.T) {
+	Register(Spec{Name: "pocket", Scope: ScopeRoom})
+	defer Unregister("pocket")
+	Register(Spec{Name: "discard", Scope: ScopeInventory})
+	defer Unregister("discard")
+
+	c := DoCommand("look")
+	for _, id := range []entity.Id{"T90", "T91", "T92"} {
+		c.Room.Insert(&entity.Thing{Id: id, Title: "a gold coin", Keywords: []string{"gold", "coin"}})
+	}
+	c.Actor.Insert(&entity.Thing{Id: "T93", Title: "a copper coin"})
+	ids := func(text string) string {
+		c := NewCommand(text, c.Actor, c.Room)
+		found := []string{}
+		for _, noun := range c.DirectObjs {
+			if thing := noun.Thing(); thing != nil {
+				found = append(found, string(thing.Id))
+			} else if noun.Several {
+				found = append(found, "none")
+			}
+		}
+		// the things loaded from the DB come in no particular order
+		sort.Strings(found)
+		return strings.Join(found, " ")
+	}
+
+	for text, want := range map[string]string{
+		"pocket all":          "T1 T3 T90 T91 T92",
+		"pocket all.coin":     "T90 T91 T92",
+		"pocket all.gold":     "T90 T91 T92",
+		"pocket 2 coins":      "T90 T91",
+		"pocket 5 gold coins": "T90 T91 T92",
+		"pocket all.copper":   "none",
+		"discard all":         "T93",
+		"discard all.coin":    "T93",
+		"discard all.knife":   "none",
+		"pocket 2.coin":       "T91",
+	} {
+		if got := ids(text); got != want {
+			t.Errorf("Expected '%s' to be %s, got %s", text, want, got)
+		}
+	}
+
+	c = NewCommand("pocket all.man", c.Actor, c.Room)
+	if len(c.DirectObjs) != 1 || c.DirectObjs[0].Ref != nil {
+		t.Errorf("Expected 'all' to leave people out, got %+v", c.DirectObjs)
+	}
+}
+
+func TestContainers(t *testing.T) {
+	Register(Spec{Name: "pocket", Scope: ScopeRoom})
+	defer Unregister("pocket")
+
+	c := DoCommand("look in bucket")
+	if c.Preposition != "in" || len(c.DirectObjs) != 0 || c.IndirectObjs[0].Thing() == nil {
+		t.Fatalf("Expected to look in the bucket, got %+v", c)
+	}
+	bucket := c.IndirectObjs[0].Thing()
+	knife := c.Room.Find("knife").(*entity.Thing)
+	c.Room.Remove(knife)
+	bucket.Insert(knife)
+
+	c = NewCommand("pocket knife", c.Actor, c.Room)
+	if c.DirectObjs[0].Ref != nil {
+		t.Errorf("Expected the knife in the bucket not to be found in the room")
+	}
+	for _, text := range []string{"pocket knife from bucket", "pocket all from pail"} {
+		c = NewCommand(text, c.Actor, c.Room)
+		if c.Preposition != "from" || len(c.DirectObjs) != 1 || c.DirectObjs[0].Thing() != knife {
+			t.Errorf("Expected '%s' to find the knife in the bucket, got %+v", text, c.DirectObjs)
+		}
+		if c.IndirectObjs[0].Thing() != bucket {
+			t.Errorf("Expected '%s' to take it from the bucket, got %+v", text, c.IndirectObjs)
+		}
+	}
+}
+
+func TestLockedContainers(t *testing.T) {
+	scripts, err := LoadScripts("../lib/commands.lua")
+	if err != nil {
+		t.Fatalf("Unable to load scripts: %s", err)
+	}
+	defer scripts.Close()
+	scripts.Install()
+	defer useScripted(nil)
+
+	c := DoCommand("look in bucket")
+	bucket := c.IndirectObjs[0].Thing()
+	knife := c.Room.Find("knife").(*entity.Thing)
+	c.Room.Remove(knife)
+	bucket.Insert(knife)
+	bucket.Flags |= entity.FlagLocked
+
+	var out bytes.Buffer
+	for _, text := range []string{"look in bucket", "take knife from bucket"} {
+		out.Reset()
+		Perform(NewCommand(text, c.Actor, c.Room), &out, scripts)
+		if !strings.Contains(out.String(), "is closed") {
+			t.Errorf("Expected '%s' to find a locked bucket closed, got '%s'", text, out.String())
+		}
+	}
+	if knife.ParentId != bucket.Id {
+		t.Error("Expected the knife to stay in the locked bucket")
+	}
+}
+
+func TestEquipment(t *testing.T) {
+	Register(Spec{Name: "doff", Scope: ScopeEquipment})
+	defer Unregister("doff")
+	Register(Spec{Name: "stow", Scope: ScopeInventory})
+	defer Unregister("stow")
+
+	c := DoCommand("look")
+	knife := c.Room.Find("knife").(*entity.Thing)
+	c.Room.Remove(knife)
+	c.Actor.Insert(knife)
+	if c = NewCommand("doff knife", c.Actor, c.Room); c.DirectObjs[0].Ref != nil {
+		t.Error("Expected a knife that's only carried not to be found among the equipment")
+	}
+	if err := c.Actor.Wield(knife); err != nil {
+		t.Fatalf("Expected to wield the knife, got %s", err)
+	}
+	if c = NewCommand("doff knife", c.Actor, c.Room); c.DirectObjs[0].Thing() != knife {
+		t.Error("Expected to find the knife being wielded")
+	}
+	if c = NewCommand("stow all", c.Actor, c.Room); len(c.DirectObjs) != 1 || c.DirectObjs[0].Ref != nil {
+		t.Errorf("Expected a wielded knife not to be among what's carried, got %+v", c.DirectObjs)
+	}
+
+	var out bytes.Buffer
+	Perform(NewCommand("eq", c.Actor, c.Room), &out, nil)
+	if !strings.Contains(out.String(), "<main hand>  tin knife\n") || !strings.Contains(out.String(), "<head>       nothing\n") {
+		t.Errorf("Expected the knife in the equipment list, got '%s'", out.String())
+	}
+}
+
+func TestHiddenThings(t *testing.T) {
+	Register(Spec{Name: "pocket", Scope: ScopeRoom})
+	defer Unregister("pocket")
+
+	c := DoCommand("look")
+	knife := c.Room.Find("knife").(*entity.Thing)
+	knife.Flags |= entity.FlagHidden
+	if c = NewCommand("pocket knife", c.Actor, c.Room); c.DirectObjs[0].Ref != nil {
+		t.Error("Expected a hidden knife not to be found")
+	}
+	c = NewCommand("pocket all", c.Actor, c.Room)
+	for _, noun := range c.DirectObjs {
+		if noun.Ref == knife {
+			t.Error("Expected 'all' to leave out the hidden knife")
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package command
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	entity "rob.co/textcrawl/entity"
+)
+
+// listEquipment "equipment" lists what the actor has in each slot.
+func listEquipment(cmd Command, writer io.Writer) (bool, error) {
+	var b strings.Builder
+	b.WriteString("You are using:\n")
+	for _, slot := range entity.Slots {
+		title := "nothing"
+		if thing := cmd.Actor.Equipped(slot); thing != nil {
+			title = thing.Title
+		}
+		_, _ = fmt.Fprintf(&b, "  %-12s %s\n", "<"+slot.String()+">", title)
+	}
+	_, _ = writer.Write([]byte(b.String()))
+	return true, nil
+}
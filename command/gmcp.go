@@ -0,0 +1,96 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// A GMCPWriter is a writer that can also carry GMCP messages to the client's UI.
+// Writers that can't (or whose client didn't ask for GMCP) just drop them.
+type GMCPWriter interface {
+	io.Writer
+	SendGMCP(pkg string, data any) error
+}
+
+// SendGMCP Send a GMCP message to w if it supports them.
+func SendGMCP(w io.Writer, pkg string, data any) {
+	gw, ok := w.(GMCPWriter)
+	if !ok {
+		return
+	}
+	if err := gw.SendGMCP(pkg, data); err != nil {
+		log.Printf("WARN: %s", err)
+	}
+}
+
+// SendGMCP Lets scripts send their own GMCP packages, e.g.
+//
+//	req:SendGMCP("Char.Status", {level = 3, class = "thief"})
+//
+// Returns why not, if data can't be sent as JSON.
+func (r *ScriptRequest) SendGMCP(pkg string, data lua.LValue) error {
+	v, err := luaToGo(data, map[*lua.LTable]bool{})
+	if err != nil {
+		return fmt.Errorf("can't send %s: %w", pkg, err)
+	}
+	SendGMCP(r.Writer, pkg, v)
+	return nil
+}
+
+// Tables nested deeper than this can't be sent
+const maxGMCPDepth = 32
+
+// luaToGo Convert a Lua value into something encoding/json can handle.
+// Tables with only consecutive integer keys from 1 become slices; any other
+// table becomes a map keyed by the string form of its keys. Tables that contain
+// themselves, or are nested too deep, are refused, as are functions and Go values.
+// within holds the tables v is inside.
+func luaToGo(v lua.LValue, within map[*lua.LTable]bool) (any, error) {
+	switch v := v.(type) {
+	case *lua.LNilType:
+		return nil, nil
+	case lua.LBool:
+		return bool(v), nil
+	case lua.LNumber:
+		return float64(v), nil
+	case lua.LString:
+		return string(v), nil
+	case *lua.LTable:
+		if within[v] {
+			return nil, errors.New("a table can't contain itself")
+		}
+		if len(within) >= maxGMCPDepth {
+			return nil, errors.New("tables are nested too deep")
+		}
+		within[v] = true
+		defer delete(within, v)
+		var err error
+		if n := v.Len(); n > 0 && countKeys(v) == n {
+			list := make([]any, n)
+			for i := 1; i <= n && err == nil; i++ {
+				list[i-1], err = luaToGo(v.RawGetInt(i), within)
+			}
+			return list, err
+		}
+		m := make(map[string]any)
+		v.ForEach(func(key lua.LValue, val lua.LValue) {
+			if err == nil {
+				m[key.String()], err = luaToGo(val, within)
+			}
+		})
+		return m, err
+	}
+	return nil, fmt.Errorf("a %s can't be sent", v.Type())
+}
+
+func countKeys(t *lua.LTable) int {
+	n := 0
+	t.ForEach(func(_ lua.LValue, _ lua.LValue) {
+		n++
+	})
+	return n
+}
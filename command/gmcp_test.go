@@ -0,0 +1,79 @@
+package command
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type gmcpRecorder struct {
+	bytes.Buffer
+	pkgs []string
+	data []any
+}
+
+func (g *gmcpRecorder) SendGMCP(pkg string, data any) error {
+	g.pkgs = append(g.pkgs, pkg)
+	g.data = append(g.data, data)
+	return nil
+}
+
+func TestScriptGMCP(t *testing.T) {
+	scripts := loadTestScripts(t, `
+function status(req)
+	req:SendGMCP("Char.Status", {level = 3, tags = {"a", "b"}, ok = true})
+end`)
+	var out gmcpRecorder
+	if _, err := scripts.Call(DoCommand("status"), &out); err != nil {
+		t.Fatalf("status failed: %s", err)
+	}
+	if len(out.pkgs) != 1 || out.pkgs[0] != "Char.Status" {
+		t.Fatalf("Expected one Char.Status message but got %v", out.pkgs)
+	}
+	expected := map[string]any{
+		"level": float64(3),
+		"tags":  []any{"a", "b"},
+		"ok":    true,
+	}
+	if !reflect.DeepEqual(out.data[0], expected) {
+		t.Errorf("Expected %v but got %v", expected, out.data[0])
+	}
+}
+
+func TestScriptGMCPRefusesBadData(t *testing.T) {
+	scripts := loadTestScripts(t, `
+function loop(req)
+	local t = {} t.me = t
+	req:Write(req:SendGMCP("x", t):Error())
+end
+function deep(req)
+	local t = {}
+	for i = 1, 100 do t = {t} end
+	req:Write(req:SendGMCP("x", t):Error())
+end
+function leak(req)
+	req:Write(req:SendGMCP("x", {actor = req.Actor}):Error())
+end
+function twice(req)
+	local t = {1}
+	if req:SendGMCP("x", {a = t, b = t}) == nil then req:Write("ok") end
+end`)
+	for action, want := range map[string]string{
+		"loop":  "a table can't contain itself",
+		"deep":  "nested too deep",
+		"leak":  "a userdata can't be sent",
+		"twice": "ok",
+	} {
+		var out gmcpRecorder
+		if _, err := scripts.Call(DoCommand(action), &out); err != nil {
+			t.Fatalf("%s failed: %s", action, err)
+		}
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected %s to get '%s', got '%s'", action, want, out.String())
+		}
+		if want != "ok" && len(out.pkgs) != 0 {
+			t.Errorf("Expected %s not to send anything, got %v", action, out.pkgs)
+		}
+	}
+}
@@ -1,9 +0,0 @@
-package command
-
-import (
-	"io"
-)
-
-func goDirection(cmd Command, writer io.Writer) (bool, error) {
-	return true, nil
-}
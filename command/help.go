@@ -0,0 +1,61 @@
+package command
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// help "help" lists the commands the player can use; "help <command>" explains one.
+func help(cmd Command, writer io.Writer) (bool, error) {
+	args := cmd.Words()
+	if len(args) == 0 {
+		allowed := []string{}
+		for _, spec := range Commands() {
+			if spec.Allows(cmd.Actor) {
+				allowed = append(allowed, spec.Name)
+			}
+		}
+		_, _ = fmt.Fprintf(writer, "Commands: %s\nType 'help <command>' to find out more about one.\n",
+			strings.Join(allowed, ", "))
+		return true, nil
+	}
+	spec, candidates := Resolve(args[0], cmd.Actor)
+	if len(candidates) > 0 {
+		_, _ = fmt.Fprintf(writer, "'%s' could be %s. Which did you mean?\n", args[0], orList(names(candidates)))
+		return true, nil
+	}
+	if spec == nil || !spec.Allows(cmd.Actor) {
+		_, _ = fmt.Fprintf(writer, "There's no command called '%s'.\n", args[0])
+		return true, nil
+	}
+	_, _ = writer.Write([]byte(describe(spec)))
+	return true, nil
+}
+
+// describe The help text for a command.
+func describe(spec *Spec) string {
+	var b strings.Builder
+	b.WriteString("{W}" + spec.Name + "{x}")
+	if len(spec.Aliases) > 0 {
+		b.WriteString(" (also " + strings.Join(spec.Aliases, ", ") + ")")
+	}
+	b.WriteString("\n")
+	if spec.Syntax != "" {
+		b.WriteString("Usage: " + spec.Syntax + "\n")
+	}
+	if spec.Help != "" {
+		b.WriteString(spec.Help + "\n")
+	}
+	var not []string
+	if !spec.Resting {
+		not = append(not, "resting")
+	}
+	if !spec.Fighting {
+		not = append(not, "fighting")
+	}
+	if len(not) > 0 {
+		b.WriteString("You can't do this while " + strings.Join(not, " or ") + ".\n")
+	}
+	return b.String()
+}
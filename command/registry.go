@@ -0,0 +1,276 @@
+package command
+
+import (
+	"log"
+	"sort"
+	"strings"
+	"sync"
+
+	entity "rob.co/textcrawl/entity"
+)
+
+// A Spec describes a command: what it's called, who may use it and when, and
+// what it does. Go code registers them with Register; Lua scripts register theirs
+// with command{...} as they load.
+// Nothing can rest or fight yet, so for now Resting and Fighting only show up in help.
+type Spec struct {
+	Name      string
+	Aliases   []string    // other words for the same command, e.g. "l" for look
+	MinPrefix int         // the shortest abbreviation of Name allowed; 0 means any that's unique
+	Priority  int         // when an abbreviation fits several commands, the highest priority wins
+	Role      entity.Role // the least role allowed to use it
+	Help      string      // a sentence or two for "help"
+	Syntax    string      // how to use it, e.g. "give <thing> to <someone>"
+	Resting   bool        // usable while resting
+	Fighting  bool        // usable while fighting
+	Scope     Scope       // where to look for the things it's given
+	Action    string      // what to perform, if not Name
+	Args      []string    // params passed ahead of the command's own, e.g. the direction for goDirection
+	Handler   Action      // the Go implementation. Without one, the Lua function named by the action is called
+}
+
+// A Scope says where a command looks for the things it's given.
+type Scope int
+
+const (
+	ScopeAnywhere  Scope = iota // the room, then the actor's inventory
+	ScopeRoom                   // only the room
+	ScopeInventory              // only what the actor is carrying, but not wearing or wielding
+	ScopeEquipment              // only what the actor is wearing or wielding
+)
+
+var scopeNames = map[string]Scope{
+	"anywhere":  ScopeAnywhere,
+	"room":      ScopeRoom,
+	"inventory": ScopeInventory,
+	"equipment": ScopeEquipment,
+}
+
+// action The name of the action this command performs.
+func (s *Spec) action() string {
+	if s.Action != "" {
+		return s.Action
+	}
+	return s.Name
+}
+
+// Allows Whether the actor may use the command. Commands nobody registered
+// are open to everyone.
+func (s *Spec) Allows(actor *entity.Actor) bool {
+	return s == nil || s.Role == entity.RolePlayer || (actor != nil && actor.Player.Role >= s.Role)
+}
+
+// named Whether word is the command's name or one of its aliases.
+func (s *Spec) named(word string) bool {
+	if word == s.Name {
+		return true
+	}
+	for _, alias := range s.Aliases {
+		if word == alias {
+			return true
+		}
+	}
+	return false
+}
+
+// abbreviates Whether word is an abbreviation of the command's name at least MinPrefix long.
+func (s *Spec) abbreviates(word string) bool {
+	return len(word) >= s.MinPrefix && strings.HasPrefix(s.Name, word)
+}
+
+// The registry holds the commands Go has registered and those from the live
+// scripts. Go's come first, so a script can't take over a built in command.
+var registry = struct {
+	sync.RWMutex
+	builtin  []*Spec
+	scripted []*Spec
+}{}
+
+// Register Add a Go command, replacing any already registered under the same name.
+func Register(spec Spec) {
+	registry.Lock()
+	defer registry.Unlock()
+	for i, s := range registry.builtin {
+		if s.Name == spec.Name {
+			registry.builtin[i] = &spec
+			return
+		}
+	}
+	registry.builtin = append(registry.builtin, &spec)
+}
+
+// Unregister Remove a Go command.
+func Unregister(name string) {
+	registry.Lock()
+	defer registry.Unlock()
+	for i, s := range registry.builtin {
+		if s.Name == name {
+			registry.builtin = append(registry.builtin[:i], registry.builtin[i+1:]...)
+			return
+		}
+	}
+}
+
+// Lookup Find the command the player means by word. Returns nil if there's no
+// such command, or more than one it could be.
+func Lookup(word string) *Spec {
+	spec, _ := Resolve(word, nil)
+	return spec
+}
+
+// Resolve Find the command actor means by word. Exact names and aliases win,
+// whoever's asking. Otherwise word can be the start of the name of any command
+// the actor is allowed to use, as long as only one of them has the highest
+// priority. If several do, they're returned instead, sorted by name.
+func Resolve(word string, actor *entity.Actor) (*Spec, []*Spec) {
+	word = strings.ToLower(word)
+	if word == "" {
+		return nil, nil
+	}
+	registry.RLock()
+	defer registry.RUnlock()
+	var best []*Spec
+	seen := map[string]bool{}
+	for _, specs := range [][]*Spec{registry.builtin, registry.scripted} {
+		for _, s := range specs {
+			if s.named(word) {
+				return s, nil
+			}
+			if seen[s.Name] || !s.abbreviates(word) || !s.Allows(actor) {
+				continue
+			}
+			seen[s.Name] = true
+			switch {
+			case len(best) == 0 || s.Priority > best[0].Priority:
+				best = []*Spec{s}
+			case s.Priority == best[0].Priority:
+				best = append(best, s)
+			}
+		}
+	}
+	if len(best) == 1 {
+		return best[0], nil
+	}
+	sort.Slice(best, func(i, j int) bool {
+		return best[i].Name < best[j].Name
+	})
+	return nil, best
+}
+
+// Commands Every registered command, sorted by name.
+func Commands() []*Spec {
+	registry.RLock()
+	specs := append(append([]*Spec{}, registry.builtin...), registry.scripted...)
+	registry.RUnlock()
+	sort.SliceStable(specs, func(i, j int) bool {
+		return specs[i].Name < specs[j].Name
+	})
+	return specs
+}
+
+// luaBuiltins The Go commands without a Handler, which call a Lua function instead.
+func luaBuiltins() []*Spec {
+	registry.RLock()
+	defer registry.RUnlock()
+	specs := []*Spec{}
+	for _, s := range registry.builtin {
+		if s.Handler == nil {
+			specs = append(specs, s)
+		}
+	}
+	return specs
+}
+
+// useScripted Replace the commands registered by the previous scripts.
+func useScripted(specs []*Spec) {
+	registry.Lock()
+	defer registry.Unlock()
+	for _, s := range specs {
+		for _, b := range registry.builtin {
+			if b.Name == s.Name {
+				log.Printf("WARN: script command '%s' is hidden by the built in one", s.Name)
+			}
+		}
+	}
+	registry.scripted = specs
+}
+
+// The commands every world has. Their implementations are in the Lua scripts.
+func init() {
+	// "nor" is north rather than northeast or northwest
+	for _, dir := range []struct {
+		name, alias string
+		priority    int
+	}{
+		{"north", "n", 10},
+		{"south", "s", 10},
+		{"east", "e", 10},
+		{"west", "w", 10},
+		{"northeast", "ne", 0},
+		{"northwest", "nw", 0},
+		{"southeast", "se", 0},
+		{"southwest", "sw", 0},
+	} {
+		Register(Spec{
+			Name:     dir.name,
+			Aliases:  []string{dir.alias},
+			Priority: dir.priority,
+			Help:     "Walk " + dir.name + ", if there's a way out in that direction.",
+			Syntax:   dir.name,
+			Action:   "goDirection",
+			Args:     []string{dir.name},
+		})
+	}
+	Register(Spec{
+		Name:     "look",
+		Aliases:  []string{"l"},
+		Priority: 10,
+		Help:     "Look around the room you're in, or inside a container.",
+		Syntax:   "look [in <container>]",
+		Resting:  true,
+		Fighting: true,
+	})
+	Register(Spec{
+		Name:     "inventory",
+		Aliases:  []string{"i"},
+		Priority: 10,
+		Help:     "List what you're carrying.",
+		Syntax:   "inventory",
+		Resting:  true,
+		Fighting: true,
+	})
+	Register(Spec{
+		Name:     "equipment",
+		Aliases:  []string{"eq"},
+		Help:     "List what you're wearing and wielding.",
+		Syntax:   "equipment",
+		Resting:  true,
+		Fighting: true,
+		Handler:  listEquipment,
+	})
+	Register(Spec{
+		Name:     "width",
+		Help:     "Show or set the width your output is wrapped to. \"auto\" uses what your client reports.",
+		Syntax:   "width [<columns>|auto]",
+		Resting:  true,
+		Fighting: true,
+		Handler:  setWidth,
+	})
+	Register(Spec{
+		Name:     "color",
+		Aliases:  []string{"colour"},
+		Help:     "Show whether colour is on, or turn it on or off.",
+		Syntax:   "color [on|off]",
+		Resting:  true,
+		Fighting: true,
+		Handler:  setColor,
+	})
+	Register(Spec{
+		Name:     "help",
+		Help:     "List the commands you can use, or explain one of them.",
+		Syntax:   "help [<command>]",
+		Resting:  true,
+		Fighting: true,
+		Handler:  help,
+	})
+}
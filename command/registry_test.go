@@ -0,0 +1,226 @@
+package command
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	entity "rob.co/textcrawl/entity"
+)
+
+func TestLookup(t *testing.T) {
+	Register(Spec{Name: "examine", Aliases: []string{"x"}, MinPrefix: 3})
+	defer Unregister("examine")
+
+	for word, want := range map[string]string{
+		"examine": "examine",
+		"x":       "examine",
+		"exa":     "examine",
+		"EXAM":    "examine",
+		"ex":      "",
+		"exits":   "",
+		"i":       "inventory",
+		"inv":     "inventory",
+		"colour":  "color",
+	} {
+		spec := Lookup(word)
+		got := ""
+		if spec != nil {
+			got = spec.Name
+		}
+		if got != want {
+			t.Errorf("Expected '%s' to find '%s', got '%s'", word, want, got)
+		}
+	}
+
+	action, params := TranslateAction("ne")
+	if action != "goDirection" || len(params) != 1 || params[0] != "northeast" {
+		t.Errorf("Expected ne to be goDirection northeast, got %s %v", action, params)
+	}
+	action, params = TranslateAction("frobnicate")
+	if action != "frobnicate" || len(params) != 0 {
+		t.Errorf("Expected an unregistered verb to be its own action, got %s %v", action, params)
+	}
+}
+
+func TestAbbreviation(t *testing.T) {
+	for _, spec := range []Spec{
+		{Name: "lock"},
+		{Name: "smile"},
+		{Name: "smirk"},
+		{Name: "smite", Role: entity.RoleAdmin},
+		{Name: "quaff", MinPrefix: 2},
+	} {
+		Register(spec)
+		defer Unregister(spec.Name)
+	}
+
+	for word, want := range map[string]string{
+		"lo":     "look",
+		"loc":    "lock",
+		"inve":   "inventory",
+		"nor":    "north",
+		"northe": "northeast",
+		"smil":   "smile",
+		"q":      "",
+		"qu":     "quaff",
+	} {
+		spec := Lookup(word)
+		got := ""
+		if spec != nil {
+			got = spec.Name
+		}
+		if got != want {
+			t.Errorf("Expected '%s' to find '%s', got '%s'", word, want, got)
+		}
+	}
+
+	var out bytes.Buffer
+	c := DoCommand("sm")
+	if c.Spec != nil || len(c.Candidates) != 2 {
+		t.Fatalf("Expected 'sm' to be ambiguous between two commands, got %v %v", c.Spec, c.Candidates)
+	}
+	Perform(c, &out, nil)
+	if out.String() != "'sm' could be smile or smirk. Which did you mean?\n" {
+		t.Errorf("Expected to be told the candidates, got '%s'", out.String())
+	}
+
+	c.Actor.Player.Role = entity.RoleAdmin
+	c = NewCommand("sm", c.Actor, c.Room)
+	if len(c.Candidates) != 3 {
+		t.Errorf("Expected an admin to have smite as a candidate too, got %v", c.Candidates)
+	}
+}
+
+func TestScriptedCommands(t *testing.T) {
+	scripts := loadTestScripts(t, `
+command{ name = "shout", aliases = {"yell"}, prefix = 2, syntax = "shout <words>", help = "Be loud." }
+command{ name = "smite", role = "admin", action = "hit", args = {"hard"} }
+command{ name = "look", help = "Not this one." }
+function shout(req) req:Write("SHOUT") end
+function hit(req, how) req:Write("hit " .. how) end
+function look(req) req:Write("scripted look") end
+`)
+	if Lookup("yell") != nil {
+		t.Fatal("Expected scripted commands to wait until they're installed")
+	}
+	scripts.Install()
+	defer useScripted(nil)
+
+	var out bytes.Buffer
+	Perform(DoCommand("sh hello"), &out, scripts)
+	if out.String() != "SHOUT" {
+		t.Errorf("Expected 'sh' to shout, got '%s'", out.String())
+	}
+
+	out.Reset()
+	c := DoCommand("smite")
+	Perform(c, &out, scripts)
+	if out.String() != "You aren't allowed to do that.\n" {
+		t.Errorf("Expected a player to be refused, got '%s'", out.String())
+	}
+	out.Reset()
+	c.Actor.Player.Role = entity.RoleAdmin
+	Perform(c, &out, scripts)
+	if out.String() != "hit hard" {
+		t.Errorf("Expected smite to hit hard, got '%s'", out.String())
+	}
+
+	if Lookup("look").Help == "Not this one." {
+		t.Error("Expected the built in look to win over the scripted one")
+	}
+
+	dir := t.TempDir()
+	missing := filepath.Join(dir, "missing.lua")
+	os.WriteFile(missing, []byte(`command{ name = "wave" }
+function look(req) end
+`), 0644)
+	if _, err := LoadScripts(missing); err == nil {
+		t.Error("Expected a command without a function to be rejected")
+	}
+	nameless := filepath.Join(dir, "nameless.lua")
+	os.WriteFile(nameless, []byte(`command{ help = "who knows" }
+function look(req) end
+`), 0644)
+	if _, err := LoadScripts(nameless); err == nil {
+		t.Error("Expected a command without a name to be rejected")
+	}
+}
+
+func TestHelp(t *testing.T) {
+	Register(Spec{Name: "secret", Role: entity.RoleAdmin, Help: "Shh."})
+	defer Unregister("secret")
+
+	var out bytes.Buffer
+	c := DoCommand("help")
+	Perform(c, &out, nil)
+	if !strings.Contains(out.String(), "look, north") || strings.Contains(out.String(), "secret") {
+		t.Errorf("Expected a list of the player's commands, got '%s'", out.String())
+	}
+
+	out.Reset()
+	Perform(DoCommand("help l"), &out, nil)
+	want := "{W}look{x} (also l)\nUsage: look [in <container>]\nLook around the room you're in, or inside a container.\n"
+	if out.String() != want {
+		t.Errorf("Expected '%s', got '%s'", want, out.String())
+	}
+
+	out.Reset()
+	Perform(DoCommand("help secret"), &out, nil)
+	if out.String() != "There's no command called 'secret'.\n" {
+		t.Errorf("Expected admin commands to be hidden from players, got '%s'", out.String())
+	}
+
+	out.Reset()
+	Perform(DoCommand("help sw"), &out, nil)
+	if !strings.HasSuffix(out.String(), "You can't do this while resting or fighting.\n") {
+		t.Errorf("Expected help to say when a command can't be used, got '%s'", out.String())
+	}
+}
+
+func TestUnregisteredActions(t *testing.T) {
+	scripts := loadTestScripts(t, `
+command{ name = "shutdown", role = "admin", action = "doShutdown" }
+command{ name = "smile" }
+command{ name = "smirk" }
+function doShutdown(req) req:Write("shutting down") end
+function smile(req) req:Write("smile") end
+function smirk(req) req:Write("smirk") end
+function sm(req) req:Write("sm") end
+`)
+	scripts.Install()
+	defer useScripted(nil)
+
+	for text, want := range map[string]string{
+		"shutdown":       "You aren't allowed to do that.\n",
+		"doShutdown":     "Huh?\n",
+		"goDirection sw": "Huh?\n",
+		"command":        "Huh?\n",
+		"sm":             "'sm' could be smile or smirk. Which did you mean?\n",
+	} {
+		var out bytes.Buffer
+		Perform(DoCommand(text), &out, scripts)
+		if out.String() != want {
+			t.Errorf("Expected '%s' to get '%s', got '%s'", text, want, out.String())
+		}
+	}
+}
+
+func TestCheckBuiltins(t *testing.T) {
+	scripts := loadTestScripts(t, `
+function goDirection(req, dir) end
+function inventory(req) end`)
+	if err := scripts.CheckBuiltins(); err == nil || !strings.Contains(err.Error(), "look") {
+		t.Errorf("Expected scripts without look to be refused, got %v", err)
+	}
+	full, err := LoadScripts("../lib/commands.lua")
+	if err != nil {
+		t.Fatalf("Unable to load scripts: %s", err)
+	}
+	defer full.Close()
+	if err := full.CheckBuiltins(); err != nil {
+		t.Errorf("Expected the real scripts to have every built in, got %s", err)
+	}
+}
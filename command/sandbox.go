@@ -0,0 +1,243 @@
+package command
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"runtime/metrics"
+	"strings"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// ScriptTimeout How long a single script invocation may run before we abandon it.
+// The engine handles every player's command on one goroutine per tick, so this
+// needs to stay well under the heartbeat interval.
+var ScriptTimeout = 250 * time.Millisecond
+
+// Limits on how much of the Lua VM's stacks a script may use.
+const (
+	scriptCallStackSize   = 200
+	scriptRegistrySize    = 1024 * 4
+	scriptRegistryMaxSize = 1024 * 64
+)
+
+// ScriptMemory How many bytes a single script invocation may allocate before we abandon it.
+var ScriptMemory uint64 = 64 << 20
+
+// maxScriptString The longest string string.rep and table.concat will build. Those,
+// and wide string.format fields, could otherwise allocate far more than ScriptMemory
+// in one go, before there's a chance to stop them.
+const maxScriptString = 1 << 20
+
+// How often a running script's allocations are checked against ScriptMemory.
+const scriptMemoryCheck = time.Millisecond
+
+// ErrScriptTimeout is returned when a script exceeded ScriptTimeout.
+var ErrScriptTimeout = errors.New("script took too long")
+
+// ErrScriptMemory is returned when a script allocated more than ScriptMemory.
+var ErrScriptMemory = errors.New("script used too much memory")
+
+// ErrScriptPanicked is returned when Go code called from a script panicked. The
+// state may have been left half unwound, so it shouldn't be used again.
+var ErrScriptPanicked = errors.New("script panicked")
+
+// libraries scripts are allowed to use. Notably absent are os, io, package and debug.
+var sandboxLibs = []struct {
+	name string
+	fn   lua.LGFunction
+}{
+	{lua.BaseLibName, lua.OpenBase},
+	{lua.TabLibName, lua.OpenTable},
+	{lua.StringLibName, lua.OpenString},
+	{lua.MathLibName, lua.OpenMath},
+}
+
+// base functions which would let a script reach outside the sandbox
+var sandboxBlocked = []string{
+	"collectgarbage",
+	"dofile",
+	"getfenv",
+	"load",
+	"loadfile",
+	"loadstring",
+	"module",
+	"newproxy",
+	"require",
+	"setfenv",
+	"_printregs",
+}
+
+// newSandbox Create a Lua state with a restricted standard library and bounded stacks.
+func newSandbox() *lua.LState {
+	L := lua.NewState(lua.Options{
+		SkipOpenLibs:    true,
+		CallStackSize:   scriptCallStackSize,
+		RegistrySize:    scriptRegistrySize,
+		RegistryMaxSize: scriptRegistryMaxSize,
+	})
+	for _, lib := range sandboxLibs {
+		L.Push(L.NewFunction(lib.fn))
+		L.Push(lua.LString(lib.name))
+		L.Call(1, 0)
+	}
+	for _, name := range sandboxBlocked {
+		L.SetGlobal(name, lua.LNil)
+	}
+	limitStrings(L)
+	// print goes to the log rather than the server's stdout
+	L.SetGlobal("print", L.NewFunction(func(L *lua.LState) int {
+		parts := make([]string, 0, L.GetTop())
+		for i := 1; i <= L.GetTop(); i++ {
+			parts = append(parts, L.ToStringMeta(L.Get(i)).String())
+		}
+		log.Printf("lua: %s", strings.Join(parts, "\t"))
+		return 0
+	}))
+	return L
+}
+
+// limitStrings Swap the library functions that can build a huge string in one call
+// for ones that refuse to.
+func limitStrings(L *lua.LState) {
+	str := L.GetGlobal(lua.StringLibName).(*lua.LTable)
+	L.SetField(str, "rep", L.NewFunction(strRep))
+	format := str.RawGetString("format").(*lua.LFunction).GFunction
+	L.SetField(str, "format", L.NewFunction(func(L *lua.LState) int {
+		checkFormat(L, L.CheckString(1))
+		return format(L)
+	}))
+	tbl := L.GetGlobal(lua.TabLibName).(*lua.LTable)
+	L.SetField(tbl, "concat", L.NewFunction(tabConcat))
+}
+
+// strRep string.rep, up to maxScriptString long.
+func strRep(L *lua.LState) int {
+	str := L.CheckString(1)
+	n := L.CheckInt(2)
+	if n <= 0 {
+		L.Push(lua.LString(""))
+		return 1
+	}
+	if len(str) > 0 && n > maxScriptString/len(str) {
+		L.RaiseError("string.rep: result would be too long")
+	}
+	L.Push(lua.LString(strings.Repeat(str, n)))
+	return 1
+}
+
+// tabConcat table.concat, up to maxScriptString long.
+func tabConcat(L *lua.LState) int {
+	tbl := L.CheckTable(1)
+	sep := L.OptString(2, "")
+	i := L.OptInt(3, 1)
+	j := L.OptInt(4, tbl.Len())
+	var b strings.Builder
+	for k := i; k <= j; k++ {
+		v := tbl.RawGetInt(k)
+		switch v.(type) {
+		case lua.LString, lua.LNumber:
+		default:
+			L.ArgError(1, fmt.Sprintf("invalid value (at index %d) in table for 'concat'", k))
+		}
+		if k > i {
+			b.WriteString(sep)
+		}
+		b.WriteString(v.String())
+		if b.Len() > maxScriptString {
+			L.RaiseError("table.concat: result would be too long")
+		}
+	}
+	L.Push(lua.LString(b.String()))
+	return 1
+}
+
+// checkFormat Refuse widths and precisions of more than two digits, as Lua itself does.
+func checkFormat(L *lua.LState, format string) {
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			continue
+		}
+		i++
+		for i < len(format) && strings.IndexByte("-+ #0", format[i]) >= 0 {
+			i++
+		}
+		for _, part := range []string{"width", "precision"} {
+			digits := 0
+			for i < len(format) && format[i] >= '0' && format[i] <= '9' {
+				digits++
+				i++
+			}
+			if digits > 2 {
+				L.RaiseError("string.format: invalid format (%s too long)", part)
+			}
+			if part == "width" && i < len(format) && format[i] == '.' {
+				i++
+			} else {
+				break
+			}
+		}
+	}
+}
+
+// allocated How many bytes the program has allocated since it started.
+func allocated() uint64 {
+	sample := []metrics.Sample{{Name: "/gc/heap/allocs:bytes"}}
+	metrics.Read(sample)
+	if sample[0].Value.Kind() != metrics.KindUint64 {
+		return 0
+	}
+	return sample[0].Value.Uint64()
+}
+
+// runBudgeted Run f against L with the script deadline and memory budget in force.
+// Lua errors, timeouts, running out of memory and Go panics raised from inside the
+// script all come back as errors. After ErrScriptMemory or ErrScriptPanicked, L
+// should be thrown away.
+func runBudgeted(L *lua.LState, f func() error) (err error) {
+	budget, overspent := context.WithCancelCause(context.Background())
+	defer overspent(nil)
+	ctx, cancel := context.WithTimeout(budget, ScriptTimeout)
+	defer cancel()
+	go watchMemory(ctx, allocated()+ScriptMemory, overspent)
+	L.SetContext(ctx)
+	defer L.RemoveContext()
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%w: %v", ErrScriptPanicked, r)
+		}
+	}()
+	err = f()
+	var apiErr *lua.ApiError
+	switch {
+	case err == nil:
+		return nil
+	case context.Cause(budget) == ErrScriptMemory:
+		return ErrScriptMemory
+	case ctx.Err() != nil:
+		return ErrScriptTimeout
+	case errors.As(err, &apiErr) && apiErr.Type == lua.ApiErrorPanic:
+		return fmt.Errorf("%w: %v", ErrScriptPanicked, apiErr.Object)
+	}
+	return err
+}
+
+// watchMemory Stop the script running under ctx once the program's allocations pass limit.
+func watchMemory(ctx context.Context, limit uint64, stop context.CancelCauseFunc) {
+	tick := time.NewTicker(scriptMemoryCheck)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+			if allocated() > limit {
+				stop(ErrScriptMemory)
+				return
+			}
+		}
+	}
+}
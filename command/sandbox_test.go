@@ -0,0 +1,109 @@
+package command
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func loadTestScripts(t *testing.T, src string) *Scripts {
+	f := filepath.Join(t.TempDir(), "test.lua")
+	if err := os.WriteFile(f, []byte(src), 0644); err != nil {
+		t.Fatalf("Unable to write test script: %s", err)
+	}
+	scripts, err := LoadScripts(f)
+	if err != nil {
+		t.Fatalf("Unable to load test script: %s", err)
+	}
+	t.Cleanup(scripts.Close)
+	return scripts
+}
+
+func TestSandboxTimeout(t *testing.T) {
+	scripts := loadTestScripts(t, "function spin(req) while true do end end")
+	var out bytes.Buffer
+	_, err := scripts.Call(DoCommand("spin"), &out)
+	if !errors.Is(err, ErrScriptTimeout) {
+		t.Errorf("Expected a timeout but got %v", err)
+	}
+	// the state should still be usable afterwards
+	Register(Spec{Name: "spin"})
+	defer Unregister("spin")
+	Perform(DoCommand("spin"), &out, scripts)
+	if !strings.Contains(out.String(), "too long") {
+		t.Errorf("Expected the player to be told about the timeout but got '%s'", out.String())
+	}
+}
+
+func TestSandboxStripsLibraries(t *testing.T) {
+	scripts := loadTestScripts(t, `
+function probe(req)
+	for _, name in ipairs({"os", "io", "loadfile", "dofile", "require", "debug"}) do
+		if _G[name] ~= nil then req:Write(name .. " ") end
+	end
+end`)
+	var out bytes.Buffer
+	if _, err := scripts.Call(DoCommand("probe"), &out); err != nil {
+		t.Fatalf("probe failed: %s", err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("Expected no dangerous globals but found: %s", out.String())
+	}
+}
+
+func TestSandboxError(t *testing.T) {
+	scripts := loadTestScripts(t, `function boom(req) error("kaboom") end`)
+	Register(Spec{Name: "boom"})
+	defer Unregister("boom")
+	var out bytes.Buffer
+	Perform(DoCommand("boom"), &out, scripts)
+	if out.String() != "Something went wrong.\n" {
+		t.Errorf("Expected a generic failure message but got '%s'", out.String())
+	}
+}
+
+func TestSandboxMemory(t *testing.T) {
+	scripts := loadTestScripts(t, `
+function hog(req) local s = string.rep("x", 4e8) .. "y" end
+function glue(req) local t = {} for i = 1, 2000 do t[i] = ("x"):rep(1000) end table.concat(t) end
+function pad(req) string.format("%999999999d", 1) end
+function grow(req) local s = "x" for i = 1, 40 do s = s .. s end end`)
+	for _, action := range []string{"hog", "glue", "pad"} {
+		if _, err := scripts.Call(DoCommand(action), io.Discard); err == nil || !strings.Contains(err.Error(), "too long") {
+			t.Errorf("Expected %s to be refused, got %v", action, err)
+		}
+	}
+	if _, err := scripts.Call(DoCommand("grow"), io.Discard); !errors.Is(err, ErrScriptMemory) {
+		t.Errorf("Expected grow to run out of memory, got %v", err)
+	}
+}
+
+func TestSandboxRestartsAfterPanic(t *testing.T) {
+	scripts := loadTestScripts(t, `
+count = 0
+function bump(req) count = count + 1 req:Write(tostring(count)) end
+function crash(req) req:Role() end`)
+	var out bytes.Buffer
+	cmd := DoCommand("bump")
+	if _, err := scripts.Call(cmd, &out); err != nil {
+		t.Fatalf("bump failed: %s", err)
+	}
+	before := scripts.L
+	// no actor, so Role dereferences nil
+	crash := DoCommand("crash")
+	crash.Actor = nil
+	if _, err := scripts.Call(crash, io.Discard); !errors.Is(err, ErrScriptPanicked) {
+		t.Fatalf("Expected crash to panic, got %v", err)
+	}
+	if scripts.L == before {
+		t.Error("Expected the state to be thrown away after a panic")
+	}
+	out.Reset()
+	if _, err := scripts.Call(cmd, &out); err != nil || out.String() != "1" {
+		t.Errorf("Expected a fresh state to count from 1, got '%s' (%v)", out.String(), err)
+	}
+}
@@ -0,0 +1,277 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	lua "github.com/yuin/gopher-lua"
+	luar "layeh.com/gopher-luar"
+	entity "rob.co/textcrawl/entity"
+)
+
+// A ScriptRequest is what gets handed to a Lua command function as its first argument.
+// It gives the script access to who is acting, what they asked for and where to write
+// the response.
+type ScriptRequest struct {
+	Actor  *entity.Actor
+	Cmd    Command
+	Writer io.Writer
+}
+
+// Write Send some text back to whoever issued the command.
+func (r *ScriptRequest) Write(msg string) {
+	// Same as the engine's request: nothing useful we can do with a write error here.
+	_, _ = r.Writer.Write([]byte(msg))
+}
+
+// A Quitter is a writer whose player can leave the game. The server's
+// connections implement this.
+type Quitter interface {
+	Quit()
+}
+
+// Quit End the player's session. Their actor leaves the world straight away,
+// rather than waiting around in case they come back, as it does when a
+// connection drops.
+func (r *ScriptRequest) Quit() {
+	if q, ok := r.Writer.(Quitter); ok {
+		q.Quit()
+	}
+}
+
+// Role The name of the acting player's role: player, builder, admin or owner.
+func (r *ScriptRequest) Role() string {
+	return r.Actor.Player.Role.String()
+}
+
+// HasRole Whether the acting player's role is at least the named one, so that
+// scripts can keep commands to themselves: if not req:HasRole("builder") then ... end
+func (r *ScriptRequest) HasRole(name string) bool {
+	role, err := entity.ParseRole(name)
+	if err != nil {
+		return false
+	}
+	return r.Actor.Player.Role >= role
+}
+
+// Scripts Wraps the Lua state holding our scripted commands.
+type Scripts struct {
+	path   string
+	source string // what was in the file, to start the state again from
+	L      *lua.LState
+	specs  []*Spec // what the file registered with command{...}
+}
+
+// LoadScripts Create a fresh sandboxed Lua state and run the file at path in it.
+// The commands it registers with command{...} get names, aliases, help and so on
+// like Go's, but don't go in the registry until the scripts are installed. Other
+// global functions can only be run by a registered command naming them as its action.
+func LoadScripts(path string) (*Scripts, error) {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load scripts from %s: %w", path, err)
+	}
+	s := &Scripts{
+		path:   path,
+		source: string(source),
+	}
+	if err := s.start(); err != nil {
+		return nil, fmt.Errorf("unable to load scripts from %s: %w", path, err)
+	}
+	if err := s.validate(); err != nil {
+		s.L.Close()
+		return nil, fmt.Errorf("scripts in %s are not usable: %w", path, err)
+	}
+	return s, nil
+}
+
+// start Run the source in a fresh sandboxed state, which replaces s.L.
+func (s *Scripts) start() error {
+	L := newSandbox()
+	L.SetGlobal("command", L.NewFunction(s.register))
+	err := runBudgeted(L, func() error {
+		fn, err := L.Load(strings.NewReader(s.source), s.path)
+		if err != nil {
+			return err
+		}
+		L.Push(fn)
+		return L.PCall(0, lua.MultRet, nil)
+	})
+	if err != nil {
+		L.Close()
+		return err
+	}
+	s.L = L
+	return nil
+}
+
+// restart Throw away a state a script has left unfit to use, and start again from
+// the same source. The commands it registers are the ones already installed.
+func (s *Scripts) restart() {
+	old, specs := s.L, s.specs
+	if err := s.start(); err != nil {
+		// it ran before, so this shouldn't happen; keep what we had rather than nothing
+		log.Printf("ERROR: unable to restart scripts from %s: %s", s.path, err)
+		s.specs = specs
+		return
+	}
+	s.specs = specs
+	old.Close()
+}
+
+// validate Sanity check a freshly loaded state before anyone relies on it.
+// A file that runs without error but defines no functions is almost certainly
+// a half-saved edit, so refuse it.
+func (s *Scripts) validate() error {
+	found := false
+	s.L.G.Global.ForEach(func(_ lua.LValue, v lua.LValue) {
+		if fn, ok := v.(*lua.LFunction); ok && !fn.IsG {
+			found = true
+		}
+	})
+	if !found {
+		return errors.New("no command functions defined")
+	}
+	for _, spec := range s.specs {
+		if !s.Has(spec.action()) {
+			return fmt.Errorf("command '%s' has no function '%s'", spec.Name, spec.action())
+		}
+	}
+	return nil
+}
+
+// CheckBuiltins Make sure the scripts define the function each built in command
+// without a Handler calls, so a reload can't take one of them away.
+func (s *Scripts) CheckBuiltins() error {
+	for _, spec := range luaBuiltins() {
+		if !s.Has(spec.action()) {
+			return fmt.Errorf("built in command '%s' has no function '%s'", spec.Name, spec.action())
+		}
+	}
+	return nil
+}
+
+// register The command{...} function scripts call to describe a command, e.g.
+//
+//	command{ name = "take", aliases = {"get"}, syntax = "take <thing>", help = "Pick something up." }
+//
+// The other fields are prefix, priority, role, resting, fighting, scope ("anywhere",
+// "room", "inventory" or "equipment"), action and args, as in Spec.
+func (s *Scripts) register(L *lua.LState) int {
+	t := L.CheckTable(1)
+	spec := &Spec{}
+	str := func(field string) string {
+		v := t.RawGetString(field)
+		if v == lua.LNil {
+			return ""
+		}
+		if v.Type() != lua.LTString {
+			L.ArgError(1, fmt.Sprintf("%s must be a string", field))
+		}
+		return v.String()
+	}
+	list := func(field string) []string {
+		var words []string
+		v := t.RawGetString(field)
+		if v == lua.LNil {
+			return words
+		}
+		tbl, ok := v.(*lua.LTable)
+		if !ok {
+			L.ArgError(1, fmt.Sprintf("%s must be a list of strings", field))
+		}
+		tbl.ForEach(func(_ lua.LValue, w lua.LValue) {
+			words = append(words, w.String())
+		})
+		return words
+	}
+	spec.Name = str("name")
+	if spec.Name == "" {
+		L.ArgError(1, "commands need a name")
+	}
+	spec.Aliases = list("aliases")
+	spec.Help = str("help")
+	spec.Syntax = str("syntax")
+	spec.Action = str("action")
+	spec.Args = list("args")
+	spec.Resting = lua.LVAsBool(t.RawGetString("resting"))
+	spec.Fighting = lua.LVAsBool(t.RawGetString("fighting"))
+	if n, ok := t.RawGetString("prefix").(lua.LNumber); ok {
+		spec.MinPrefix = int(n)
+	}
+	if n, ok := t.RawGetString("priority").(lua.LNumber); ok {
+		spec.Priority = int(n)
+	}
+	if name := str("scope"); name != "" {
+		scope, ok := scopeNames[name]
+		if !ok {
+			L.ArgError(1, fmt.Sprintf("there's no scope called '%s'", name))
+		}
+		spec.Scope = scope
+	}
+	if name := str("role"); name != "" {
+		role, err := entity.ParseRole(name)
+		if err != nil {
+			L.ArgError(1, err.Error())
+		}
+		spec.Role = role
+	}
+	s.specs = append(s.specs, spec)
+	return 0
+}
+
+// Install Make the commands these scripts registered the live ones, in place of
+// those from whichever scripts were installed before.
+func (s *Scripts) Install() {
+	useScripted(s.specs)
+}
+
+// Path The file these scripts were loaded from.
+func (s *Scripts) Path() string {
+	return s.path
+}
+
+// Has Is there a Lua function with this name?
+func (s *Scripts) Has(action string) bool {
+	_, ok := s.L.GetGlobal(action).(*lua.LFunction)
+	return ok
+}
+
+// Call Invoke the Lua function named by the command's action. The function gets a
+// ScriptRequest followed by the command's params as strings. It runs under the
+// sandbox's time budget, so a runaway script comes back as an error rather than
+// stalling the tick. Returns whether a function by that name existed.
+func (s *Scripts) Call(cmd Command, writer io.Writer) (bool, error) {
+	fn, ok := s.L.GetGlobal(cmd.Action).(*lua.LFunction)
+	if !ok {
+		return false, nil
+	}
+	req := &ScriptRequest{
+		Actor:  cmd.Actor,
+		Cmd:    cmd,
+		Writer: writer,
+	}
+	args := []lua.LValue{luar.New(s.L, req)}
+	for _, p := range cmd.Params {
+		args = append(args, lua.LString(p))
+	}
+	err := runBudgeted(s.L, func() error {
+		return s.L.CallByParam(lua.P{Fn: fn, NRet: 0, Protect: true}, args...)
+	})
+	if errors.Is(err, ErrScriptMemory) || errors.Is(err, ErrScriptPanicked) {
+		s.restart()
+	}
+	if err != nil {
+		return true, fmt.Errorf("script '%s' failed: %w", cmd.Action, err)
+	}
+	return true, nil
+}
+
+// Close Release the underlying Lua state.
+func (s *Scripts) Close() {
+	s.L.Close()
+}
@@ -0,0 +1,76 @@
+package command
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// A Terminal is a writer that knows something about the client's display.
+// The server's connections implement this; other writers (e.g. in tests) needn't.
+type Terminal interface {
+	io.Writer
+	Width() int
+	SetWidth(width int)
+	Color() bool
+	SetColor(on bool)
+	ColorSupported() bool
+}
+
+// setWidth Let the player override the width we wrap output to.
+// "width" reports the current width, "width auto" goes back to what the
+// client told us, and "width <n>" sets it.
+func setWidth(cmd Command, writer io.Writer) (bool, error) {
+	term, ok := writer.(Terminal)
+	if !ok {
+		_, _ = writer.Write([]byte("Your connection doesn't support that.\n"))
+		return true, nil
+	}
+	args := cmd.Words()
+	if len(args) == 0 {
+		_, _ = fmt.Fprintf(writer, "Your width is %d.\n", term.Width())
+		return true, nil
+	}
+	if args[0] == "auto" {
+		term.SetWidth(0)
+		_, _ = fmt.Fprintf(writer, "Your width is now %d.\n", term.Width())
+		return true, nil
+	}
+	width, err := strconv.Atoi(args[0])
+	if err != nil || width <= 0 {
+		_, _ = writer.Write([]byte("Usage: width [<columns>|auto]\n"))
+		return true, nil
+	}
+	term.SetWidth(width)
+	_, _ = fmt.Fprintf(writer, "Your width is now %d.\n", term.Width())
+	return true, nil
+}
+
+// setColor Let the player turn colour on or off. "color" on its own reports the setting.
+func setColor(cmd Command, writer io.Writer) (bool, error) {
+	term, ok := writer.(Terminal)
+	if !ok {
+		_, _ = writer.Write([]byte("Your connection doesn't support that.\n"))
+		return true, nil
+	}
+	args := cmd.Words()
+	if len(args) > 0 {
+		switch args[0] {
+		case "on":
+			term.SetColor(true)
+		case "off":
+			term.SetColor(false)
+		default:
+			_, _ = writer.Write([]byte("Usage: color [on|off]\n"))
+			return true, nil
+		}
+	}
+	if !term.Color() {
+		_, _ = writer.Write([]byte("Color is off.\n"))
+	} else if term.ColorSupported() {
+		_, _ = writer.Write([]byte("Color is {G}on{x}.\n"))
+	} else {
+		_, _ = writer.Write([]byte("Color is on, but your client hasn't told us it can show it.\n"))
+	}
+	return true, nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"log"
+	"sync"
+)
+
+// compressStats Running totals for a connection's MCCP2 stream.
+type compressStats struct {
+	mu  sync.Mutex
+	in  int64 // bytes handed to the compressor
+	out int64 // bytes it produced
+}
+
+func (c *compressStats) add(in int, out int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.in += int64(in)
+	c.out += int64(out)
+}
+
+func (c *compressStats) totals() (int64, int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.in, c.out
+}
+
+// A compressor produces the zlib stream MCCP2 clients expect.
+type compressor struct {
+	buf     bytes.Buffer
+	z       *zlib.Writer
+	pending int // bytes written since the last flush
+	stats   *compressStats
+}
+
+func newCompressor(stats *compressStats) *compressor {
+	c := &compressor{stats: stats}
+	c.z = zlib.NewWriter(&c.buf)
+	return c
+}
+
+func (c *compressor) write(p []byte) {
+	// Writes to a bytes.Buffer don't fail
+	if _, err := c.z.Write(p); err != nil {
+		log.Printf("Compression failed: %s", err)
+	}
+	c.pending += len(p)
+}
+
+// flush Return everything compressed so far, in a form the client can decode
+// without waiting for more.
+func (c *compressor) flush() []byte {
+	if err := c.z.Flush(); err != nil {
+		log.Printf("Compression flush failed: %s", err)
+	}
+	return c.take()
+}
+
+// finish End the stream. The compressor can't be used after this.
+func (c *compressor) finish() []byte {
+	if err := c.z.Close(); err != nil {
+		log.Printf("Compression close failed: %s", err)
+	}
+	return c.take()
+}
+
+func (c *compressor) take() []byte {
+	out := make([]byte, c.buf.Len())
+	copy(out, c.buf.Bytes())
+	c.buf.Reset()
+	c.stats.add(c.pending, len(out))
+	c.pending = 0
+	return out
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+	"testing"
+)
+
+func TestCompressor(t *testing.T) {
+	stats := &compressStats{}
+	c := newCompressor(stats)
+	text := bytes.Repeat([]byte("This is an empty room. It only exists as a sample.\n"), 20)
+	c.write(text)
+	stream := c.flush()
+	c.write([]byte("\n> "))
+	stream = append(stream, c.flush()...)
+
+	// each flush must be decodable on its own, or the client would sit waiting for more
+	r, err := zlib.NewReader(bytes.NewReader(stream))
+	if err != nil {
+		t.Fatalf("Unable to read compressed stream: %s", err)
+	}
+	got := make([]byte, len(text)+3)
+	if _, err := io.ReadFull(r, got); err != nil {
+		t.Fatalf("Unable to decompress: %s", err)
+	}
+	if !bytes.Equal(got, append(text, "\n> "...)) {
+		t.Errorf("Decompressed text doesn't match what went in")
+	}
+
+	in, out := stats.totals()
+	if in != int64(len(text)+3) {
+		t.Errorf("Expected %d bytes in but stats say %d", len(text)+3, in)
+	}
+	if out != int64(len(stream)) || out >= in {
+		t.Errorf("Expected %d bytes out, smaller than the input, but stats say %d", len(stream), out)
+	}
+}
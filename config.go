@@ -0,0 +1,101 @@
+package main
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Config Settings for the server's listeners and the world. Like the world directory
+// (TEXTCRAWL_WORLD), these come from the environment.
+type Config struct {
+	TelnetAddr string // plain telnet
+	WebAddr    string // browser client and WebSocket
+	TLSAddr    string // telnet over TLS. Empty means don't listen.
+	TLSCert    string // certificate and key files for TLS. If not set, we make
+	TLSKey     string // up a self-signed certificate, which is only fit for development.
+	RequireTLS bool   // refuse to take passwords over unencrypted connections
+	SSHAddr    string // SSH. Empty means don't listen.
+	SSHHostKey string // private key file for SSH. If not set, we make up a new one each run.
+	StartZone  string // where new characters appear: the zone
+	StartRoom  string // and the room within it, as numbered in the zone's YAML
+
+	// how long a player's actor stays in the world after their connection drops
+	LinkDeadTimeout time.Duration
+
+	LoginDelay       time.Duration // pause after a failed login, doubling with each further failure
+	MaxLoginFailures int           // failures allowed on one connection before we hang up
+	LockoutFailures  int           // failures for a username or address before it's locked out
+	LockoutDuration  time.Duration // how long a lockout lasts, and how long failures count towards one
+}
+
+// LoadConfig Read the configuration from the environment, using defaults for anything unset.
+func LoadConfig() Config {
+	return Config{
+		TelnetAddr: envOr("TEXTCRAWL_TELNET_ADDR", ":8888"),
+		WebAddr:    envOr("TEXTCRAWL_WEB_ADDR", ":8080"),
+		TLSAddr:    envOr("TEXTCRAWL_TLS_ADDR", ""),
+		TLSCert:    envOr("TEXTCRAWL_TLS_CERT", ""),
+		TLSKey:     envOr("TEXTCRAWL_TLS_KEY", ""),
+		RequireTLS: envBool("TEXTCRAWL_REQUIRE_TLS", false),
+		SSHAddr:    envOr("TEXTCRAWL_SSH_ADDR", ""),
+		SSHHostKey: envOr("TEXTCRAWL_SSH_HOST_KEY", ""),
+		StartZone:  envOr("TEXTCRAWL_START_ZONE", "1"),
+		StartRoom:  envOr("TEXTCRAWL_START_ROOM", "1"),
+
+		LinkDeadTimeout: envDuration("TEXTCRAWL_LINKDEAD_TIMEOUT", 5*time.Minute),
+
+		LoginDelay:       envDuration("TEXTCRAWL_LOGIN_DELAY", time.Second),
+		MaxLoginFailures: envInt("TEXTCRAWL_MAX_LOGIN_FAILURES", 3),
+		LockoutFailures:  envInt("TEXTCRAWL_LOCKOUT_FAILURES", 5),
+		LockoutDuration:  envDuration("TEXTCRAWL_LOCKOUT_DURATION", 15*time.Minute),
+	}
+}
+
+func envOr(name string, def string) string {
+	val, ok := os.LookupEnv(name)
+	if !ok {
+		return def
+	}
+	return val
+}
+
+func envBool(name string, def bool) bool {
+	val, ok := os.LookupEnv(name)
+	if !ok {
+		return def
+	}
+	b, err := strconv.ParseBool(val)
+	if err != nil {
+		log.Printf("WARN: %s should be true or false, not '%s'. Using %v.", name, val, def)
+		return def
+	}
+	return b
+}
+
+func envInt(name string, def int) int {
+	val, ok := os.LookupEnv(name)
+	if !ok {
+		return def
+	}
+	n, err := strconv.Atoi(val)
+	if err != nil {
+		log.Printf("WARN: %s should be a number, not '%s'. Using %d.", name, val, def)
+		return def
+	}
+	return n
+}
+
+func envDuration(name string, def time.Duration) time.Duration {
+	val, ok := os.LookupEnv(name)
+	if !ok {
+		return def
+	}
+	d, err := time.ParseDuration(val)
+	if err != nil {
+		log.Printf("WARN: %s should be a duration like 90s or 15m, not '%s'. Using %s.", name, val, def)
+		return def
+	}
+	return d
+}
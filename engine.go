@@ -4,8 +4,11 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"os"
+	"path/filepath"
 	cmd "rob.co/textcrawl/command"
 	entity "rob.co/textcrawl/entity"
+	"strings"
 	"time"
 )
 
@@ -19,16 +22,23 @@ import (
 type MessageType int
 
 const (
-	Connect MessageType = iota
-	Disconnect
+	Connect         MessageType = iota
+	Disconnect                  // the connection dropped: leave the actor link-dead for a while
+	Quit                        // the player quit: take their actor out of the world now
+	CreateCharacter             // put a newly made character in the world
 )
 
-const LuaEntrypoint = "lib/commands.lua"
+// LuaEntrypoint The script file the commands are loaded from.
+var LuaEntrypoint = "lib/commands.lua"
+
+// How often we check lib/ for edited scripts
+const scriptPollInterval = 2 * time.Second
 
 type Message struct {
-	mType  MessageType
-	Writer io.Writer
-	Player entity.Player
+	mType     MessageType
+	Writer    io.Writer
+	Player    entity.Player
+	character *characterRequest // for CreateCharacter
 }
 
 func NewMessage(t MessageType, p entity.Player, w io.Writer) Message {
@@ -70,31 +80,183 @@ func newHeartbeat(tick int, cmd string) Heartbeat {
 	}
 }
 
+// A ScriptReload carries freshly compiled scripts (or the reason they could not be
+// compiled) from the lib/ watcher to the engine.
+type ScriptReload struct {
+	scripts *cmd.Scripts
+	err     error
+}
+
 type Engine struct {
 	RequestCh   chan Request
 	HeartbeatCh chan Heartbeat
 	MessageCh   chan Message
+	ScriptCh    chan ScriptReload
+	config      Config
 	reqsByActor map[entity.Id][]Request
+	linkDead    map[entity.Id]time.Time   // actors whose players have dropped, and when to give up on them
+	unclear     map[entity.Id]cmd.Command // commands waiting for their actor to say which thing they meant
+	travelling  map[entity.Id]io.Writer   // actors on their way to another room, and where to say they've arrived
 	playerMgr   entity.PlayerMgr
 	zoneMgr     entity.ZoneManager
 	loadTime    time.Time
+	scripts     *cmd.Scripts
+	pending     *cmd.Scripts // scripts to swap in once the current tick is done
 }
 
-func NewEngine() *Engine {
+func NewEngine(config Config) *Engine {
 	zm, err := entity.GetZoneMgr()
 	if err != nil {
 		log.Fatalf("Unable to start engine: %s", err)
 	}
+	scripts, err := loadScripts()
+	if err != nil {
+		log.Fatalf("Unable to start engine: %s", err)
+	}
 
-	return &Engine{
+	e := &Engine{
 		RequestCh:   make(chan Request),
 		HeartbeatCh: make(chan Heartbeat),
 		MessageCh:   make(chan Message),
+		ScriptCh:    make(chan ScriptReload),
+		config:      config,
 		reqsByActor: make(map[entity.Id][]Request),
+		linkDead:    make(map[entity.Id]time.Time),
+		unclear:     make(map[entity.Id]cmd.Command),
+		travelling:  make(map[entity.Id]io.Writer),
 		playerMgr:   entity.NewPlayerMgr(),
 		zoneMgr:     zm,
 		loadTime:    time.Now(),
+		scripts:     scripts,
+	}
+	scripts.Install()
+	cmd.Register(cmd.Spec{
+		Name:      "reload",
+		MinPrefix: 6,
+		Role:      entity.RoleAdmin,
+		Help:      "Compile the Lua scripts again and swap them in after this tick.",
+		Syntax:    "reload",
+		Resting:   true,
+		Fighting:  true,
+		Handler: func(_ cmd.Command, w io.Writer) (bool, error) {
+			e.reloadScripts(w)
+			return true, nil
+		},
+	})
+	cmd.Register(cmd.Spec{
+		Name:     "sshkey",
+		Help:     "List, add or remove the keys you can log in over SSH with.",
+		Syntax:   "sshkey [add <public key> | remove <number>]",
+		Resting:  true,
+		Fighting: true,
+		Handler:  e.sshKeyCommand,
+	})
+	cmd.Register(cmd.Spec{
+		Name:      "role",
+		MinPrefix: 4,
+		Role:      entity.RoleAdmin,
+		Help:      "Show a player's role, or change it.",
+		Syntax:    "role <username> [player|builder|admin|owner]",
+		Resting:   true,
+		Fighting:  true,
+		Handler:   e.roleCommand,
+	})
+	// The server handles "password" itself, so that it can stop the client
+	// echoing it. This is here so help knows about it.
+	cmd.Register(cmd.Spec{
+		Name:      "password",
+		MinPrefix: 8,
+		Help:      "Change your password. You'll be asked for your current one, then the new one twice.",
+		Syntax:    "password",
+		Resting:   true,
+		Fighting:  true,
+		Handler: func(_ cmd.Command, w io.Writer) (bool, error) {
+			_, _ = w.Write([]byte("Type 'password' on its own to change your password.\n"))
+			return true, nil
+		},
+	})
+	return e
+}
+
+// reloadScripts Compile the scripts again on behalf of whoever asked. They get
+// swapped in after the current tick; if they don't compile, we keep the old ones.
+func (e *Engine) reloadScripts(w io.Writer) {
+	scripts, err := loadScripts()
+	if err != nil {
+		log.Printf("WARN: script reload failed: %s", err)
+		_, _ = w.Write([]byte(fmt.Sprintf("Reload failed, keeping the old scripts:\n%s\n", err)))
+		return
+	}
+	if e.pending != nil {
+		e.pending.Close()
+	}
+	e.pending = scripts
+	_, _ = w.Write([]byte("Scripts compiled. They will take effect next tick.\n"))
+}
+
+// loadScripts Load the scripts at LuaEntrypoint, as long as they have everything
+// the built in commands need.
+func loadScripts() (*cmd.Scripts, error) {
+	scripts, err := cmd.LoadScripts(LuaEntrypoint)
+	if err != nil {
+		return nil, err
+	}
+	if err := scripts.CheckBuiltins(); err != nil {
+		scripts.Close()
+		return nil, fmt.Errorf("scripts in %s are not usable: %w", LuaEntrypoint, err)
+	}
+	return scripts, nil
+}
+
+// roleCommand The "role" command: "role <username>" shows a player's role, and
+// "role <username> <role>" changes it. Nobody can hand out a role above their own,
+// or change the role of someone who outranks them.
+func (e *Engine) roleCommand(c cmd.Command, w io.Writer) (bool, error) {
+	write := func(msg string) {
+		_, _ = w.Write([]byte(msg))
+	}
+	words := c.Words()
+	if len(words) == 0 || len(words) > 2 {
+		write("Usage: role <username> [player|builder|admin|owner]\n")
+		return true, nil
+	}
+	username := strings.ToLower(words[0])
+	current, err := e.playerMgr.LoadRole(username)
+	if err != nil {
+		write(fmt.Sprintf("There's no player called '%s'.\n", username))
+		return true, nil
 	}
+	if len(words) == 1 {
+		write(fmt.Sprintf("%s is %s.\n", username, current))
+		return true, nil
+	}
+	role, err := entity.ParseRole(words[1])
+	if err != nil {
+		write(err.Error() + ".\n")
+		return true, nil
+	}
+	mine := c.Actor.Player.Role
+	if mine != entity.RoleOwner && (role > mine || current >= mine) {
+		write("You can't do that.\n")
+		return true, nil
+	}
+	if err := e.playerMgr.SetRole(username, role); err != nil {
+		return true, err
+	}
+	log.Printf("INFO: %s made %s %s (was %s)", c.Actor.Player.Username, username, role, current)
+	write(fmt.Sprintf("%s is now %s. It takes effect when they next log in.\n", username, role))
+	return true, nil
+}
+
+// swapScripts Replace the live scripts. Only call this between ticks.
+func (e *Engine) swapScripts(scripts *cmd.Scripts) {
+	old := e.scripts
+	e.scripts = scripts
+	scripts.Install()
+	if old != nil {
+		old.Close()
+	}
+	log.Printf("INFO: loaded scripts from %s", scripts.Path())
 }
 
 func (e *Engine) sendPrompt(req Request) {
@@ -125,14 +287,36 @@ func (e *Engine) Run() {
 				return
 			}
 			e.processRequests(hb)
+			e.reapLinkDead(time.Now())
+			if e.pending != nil {
+				e.swapScripts(e.pending)
+				e.pending = nil
+			}
+		case reload := <-e.ScriptCh:
+			if reload.err != nil {
+				log.Printf("WARN: script reload failed, keeping the old scripts: %s", reload.err)
+			} else {
+				e.swapScripts(reload.scripts)
+			}
 		case msg := <-e.MessageCh:
 			switch msg.mType {
 			case Connect:
 				log.Printf("INFO: %s has connected", msg.Player.ActorId)
 				e.reqsByActor[msg.Player.ActorId] = []Request{}
+				e.setActive(msg.Player, true)
+				e.rejoin(msg.Player.ActorId, msg.Writer)
 			case Disconnect:
 				log.Printf("INFO: %s has disconnected", msg.Player.ActorId)
 				delete(e.reqsByActor, msg.Player.ActorId)
+				e.setActive(msg.Player, false)
+				e.dropLink(msg.Player.ActorId)
+			case Quit:
+				log.Printf("INFO: %s has quit", msg.Player.ActorId)
+				delete(e.reqsByActor, msg.Player.ActorId)
+				e.setActive(msg.Player, false)
+				e.leave(msg.Player.ActorId)
+			case CreateCharacter:
+				e.createCharacter(msg.character)
 			}
 		}
 	}
@@ -141,8 +325,18 @@ func (e *Engine) Run() {
 func (e *Engine) processRequests(hb Heartbeat) {
 	log.Printf("tick %d", hb.tick)
 	todo := make([]Request, 0)
-	// Take the first unprocessed request we have from each actor.
+	zoneIds := make(map[entity.Id]bool)
+	// Take the first unprocessed request we have from each actor that isn't
+	// still busy with something from an earlier tick.
 	for id, q := range e.reqsByActor {
+		if e.busy(id) {
+			continue
+		}
+		if w, ok := e.travelling[id]; ok {
+			if zone := e.arrive(id, w); zone != nil {
+				zoneIds[zone.Id] = true
+			}
+		}
 		if len(q) > 0 {
 			todo = append(todo, q[0])
 			e.reqsByActor[id] = q[1:]
@@ -150,8 +344,6 @@ func (e *Engine) processRequests(hb Heartbeat) {
 	}
 	// Go through and handle each request. TODO: we should order these
 	// by init value and account for multi-tick actions.
-
-	zoneIds := make(map[entity.Id]bool)
 	for _, req := range todo {
 		a, err := e.zoneMgr.FindActor(req.Player.ActorId)
 		if err != nil {
@@ -159,9 +351,28 @@ func (e *Engine) processRequests(hb Heartbeat) {
 				req.Player.ActorId, req.Text)
 			continue
 		}
-		c := cmd.NewCommand(req.Text, a, a.Room())
+		a.Player = req.Player
+		text := req.Text
+		// if we asked which thing they meant, this is probably the answer
+		if prev, ok := e.unclear[req.Player.ActorId]; ok {
+			delete(e.unclear, req.Player.ActorId)
+			if clarified, ok := prev.Clarify(text); ok {
+				text = clarified
+			}
+		}
+		c := cmd.NewCommand(text, a, a.Room())
 		log.Print(fmt.Sprintf("processing: %s (%d)\r\n", c.Action, hb.tick))
-		cmd.Perform(c, req.Writer)
+		wasIn := a.Body.ParentId
+		cmd.Perform(c, req.Writer, e.scripts)
+		if c.Unclear() != nil {
+			e.unclear[req.Player.ActorId] = c
+		}
+		if a.Heading != nil {
+			e.travelling[a.Id] = req.Writer
+		}
+		// a blank request is the one sent at login, when the client knows nothing yet
+		moved := c.Action == "goDirection" || c.Action == "" || a.Body.ParentId != wasIn
+		sendStatus(req.Writer, a, moved)
 		e.sendPrompt(req)
 		zoneIds[a.Zone.Id] = true
 	}
@@ -175,6 +386,106 @@ func (e *Engine) processRequests(hb Heartbeat) {
 	}
 }
 
+// busy Whether the actor is still spending ticks on something it did earlier,
+// like trudging from one room to the next under a heavy load. Each call uses up one.
+func (e *Engine) busy(id entity.Id) bool {
+	a, err := e.zoneMgr.FindActor(id)
+	if err != nil || a.Busy == 0 {
+		return false
+	}
+	a.Busy--
+	return true
+}
+
+// arrive Finish the journey of an actor that set off for another room some ticks ago,
+// and describe where it's got to on w, if w isn't nil. Returns the actor's zone.
+func (e *Engine) arrive(id entity.Id, w io.Writer) *entity.Zone {
+	delete(e.travelling, id)
+	a, err := e.zoneMgr.FindActor(id)
+	if err != nil || a.Heading == nil {
+		return nil
+	}
+	a.Zone.MoveActor(a, a.Heading)
+	a.Heading = nil
+	if w != nil {
+		cmd.Perform(cmd.NewCommand("look", a, a.Room()), w, e.scripts)
+		sendStatus(w, a, true)
+		_, _ = w.Write([]byte("\n> "))
+	}
+	return a.Zone
+}
+
+// rejoin Bring a player's actor back into play, whether it's link-dead, or
+// has been out of the world since they last logged off.
+func (e *Engine) rejoin(id entity.Id, w io.Writer) {
+	a, err := e.zoneMgr.FindActor(id)
+	if err != nil {
+		log.Printf("WARN: %s has connected, but has no actor: %s", id, err)
+		return
+	}
+	if a.LinkDead {
+		log.Printf("INFO: %s has reconnected", id)
+		_, _ = w.Write([]byte("You have reconnected.\n"))
+	}
+	delete(e.linkDead, id)
+	a.LinkDead = false
+	a.Zone.Restore(a)
+	if _, ok := e.travelling[id]; ok {
+		e.travelling[id] = w
+	}
+}
+
+// dropLink Leave a disconnected player's actor where it is for a while, in case they come back.
+func (e *Engine) dropLink(id entity.Id) {
+	a, err := e.zoneMgr.FindActor(id)
+	if err != nil {
+		return
+	}
+	a.LinkDead = true
+	e.linkDead[id] = time.Now().Add(e.config.LinkDeadTimeout)
+}
+
+// reapLinkDead Take actors out of the world once their players have been gone too long.
+func (e *Engine) reapLinkDead(now time.Time) {
+	for id, deadline := range e.linkDead {
+		if now.Before(deadline) {
+			continue
+		}
+		log.Printf("INFO: %s has been link-dead too long, removing them from the world", id)
+		e.leave(id)
+	}
+}
+
+// leave Save an actor and take it out of the world, until its player logs in again.
+func (e *Engine) leave(id entity.Id) {
+	delete(e.linkDead, id)
+	a, err := e.zoneMgr.FindActor(id)
+	if err != nil {
+		return
+	}
+	// it gets where it was going before it goes
+	e.arrive(id, nil)
+	// save first; once it's out of its room, the zone won't save it
+	a.Zone.Save()
+	a.LinkDead = false
+	a.Zone.Withdraw(a)
+}
+
+// setActive Record whether the player is logged in, which stops them logging in twice.
+func (e *Engine) setActive(p entity.Player, active bool) {
+	if err := e.playerMgr.SetActive(p.Username, active); err != nil {
+		log.Printf("WARN: unable to mark %s as active=%v: %s", p.Username, active, err)
+	}
+}
+
+// resetActive Mark every player as logged out. Nobody can be connected while the
+// engine isn't running, whatever the DB says after a crash.
+func (e *Engine) resetActive() {
+	if err := e.playerMgr.ClearActive(); err != nil {
+		log.Printf("WARN: unable to reset logged in players: %s", err)
+	}
+}
+
 func (e *Engine) TriggerShutdown() {
 	e.HeartbeatCh <- Heartbeat{cmd: "quit"}
 }
@@ -194,12 +505,56 @@ func heartbeat(c chan Heartbeat) {
 
 }
 
+// watchScripts Poll the script directory and, whenever a .lua file in it changes,
+// compile the entrypoint into a fresh state and hand it to the engine.
+func watchScripts(dir string, c chan ScriptReload) {
+	last := latestScriptMod(dir)
+	for {
+		time.Sleep(scriptPollInterval)
+		mod := latestScriptMod(dir)
+		if !mod.After(last) {
+			continue
+		}
+		last = mod
+		scripts, err := loadScripts()
+		c <- ScriptReload{scripts: scripts, err: err}
+	}
+}
+
+// latestScriptMod Returns the most recent modification time of any Lua file in dir.
+func latestScriptMod(dir string) time.Time {
+	latest := time.Time{}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		log.Printf("WARN: unable to read script directory %s: %s", dir, err)
+		return latest
+	}
+	for _, entry := range entries {
+		if filepath.Ext(entry.Name()) != ".lua" {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest
+}
+
 func main() {
 	fmt.Println("Starting engine")
-	e := NewEngine()
-	s := NewServer(e.MessageCh, e.RequestCh, e.playerMgr)
+	config := LoadConfig()
+	e := NewEngine(config)
+	// before anyone can log in, or we'd log them out again
+	e.resetActive()
+	s := NewServer(config, e.MessageCh, e.RequestCh, e.playerMgr)
 	go s.Serve()
 	go heartbeat(e.HeartbeatCh)
+	go watchScripts(filepath.Dir(LuaEntrypoint), e.ScriptCh)
 	e.Run()
+	e.resetActive()
 	fmt.Println("Stopping")
 }
@@ -3,8 +3,12 @@ package main
 import (
 	"bytes"
 	"io"
+	"os"
+	"path/filepath"
 	entity "rob.co/textcrawl/entity"
+	"strings"
 	"testing"
+	"time"
 )
 
 type DummyPlayerMgr struct {
@@ -14,8 +18,96 @@ func (pm DummyPlayerMgr) LookupPlayer(username string, pwd string) (entity.Id, e
 	return "A1", nil
 }
 
-func newTestEngine() *Engine {
-	e := NewEngine()
+func (pm DummyPlayerMgr) LoadPrefs(username string) (entity.Prefs, error) {
+	return entity.DefaultPrefs(), nil
+}
+
+func (pm DummyPlayerMgr) SavePrefs(username string, prefs entity.Prefs) error {
+	return nil
+}
+
+func (pm DummyPlayerMgr) PlayerExists(username string) (bool, error) {
+	return username == "foo", nil
+}
+
+func (pm DummyPlayerMgr) CreatePlayer(username string, pwd string) error {
+	return nil
+}
+
+func (pm DummyPlayerMgr) SetPassword(username string, pwd string) error {
+	return nil
+}
+
+func (pm DummyPlayerMgr) SetActor(username string, actorId entity.Id) error {
+	return nil
+}
+
+func (pm DummyPlayerMgr) LoginFailures(subject string) (entity.LoginFailures, error) {
+	return entity.LoginFailures{}, nil
+}
+
+func (pm DummyPlayerMgr) SaveLoginFailures(subject string, failures entity.LoginFailures) error {
+	return nil
+}
+
+func (pm DummyPlayerMgr) ClearLoginFailures(subject string) error {
+	return nil
+}
+
+func (pm DummyPlayerMgr) LoadRole(username string) (entity.Role, error) {
+	return entity.RolePlayer, nil
+}
+
+func (pm DummyPlayerMgr) SetRole(username string, role entity.Role) error {
+	return nil
+}
+
+func (pm DummyPlayerMgr) SetActive(username string, active bool) error {
+	return nil
+}
+
+func (pm DummyPlayerMgr) ClearActive() error {
+	return nil
+}
+
+func (pm DummyPlayerMgr) LookupPlayerKey(username string, key string) (entity.Id, error) {
+	return "A1", nil
+}
+
+func (pm DummyPlayerMgr) PlayerKeys(username string) ([]string, error) {
+	return []string{}, nil
+}
+
+func (pm DummyPlayerMgr) AddPlayerKey(username string, key string) error {
+	return nil
+}
+
+func (pm DummyPlayerMgr) RemovePlayerKey(username string, key string) error {
+	return nil
+}
+
+// newTestEngine An engine running a copy of the world, so tests can change it freely.
+func newTestEngine(t *testing.T) *Engine {
+	t.Helper()
+	worldDir, ok := os.LookupEnv("TEXTCRAWL_WORLD")
+	if !ok {
+		worldDir = "./world"
+	}
+	dir := t.TempDir()
+	for _, pattern := range []string{"*.yaml", "*.dat"} {
+		files, _ := filepath.Glob(filepath.Join(worldDir, pattern))
+		for _, f := range files {
+			data, err := os.ReadFile(f)
+			if err != nil {
+				t.Fatalf("Unable to read %s: %s", f, err)
+			}
+			if err := os.WriteFile(filepath.Join(dir, filepath.Base(f)), data, 0o644); err != nil {
+				t.Fatalf("Unable to copy %s: %s", f, err)
+			}
+		}
+	}
+	t.Setenv("TEXTCRAWL_WORLD", dir)
+	e := NewEngine(LoadConfig())
 	e.playerMgr = DummyPlayerMgr{}
 	return e
 }
@@ -67,3 +159,187 @@ func (t *testSession) sendRequest(text string) {
 func (t *testSession) getResponse() string {
 	return <-t.ch
 }
+
+func TestLinkDead(t *testing.T) {
+	e := newTestEngine(t)
+	a, err := e.zoneMgr.FindActor("A1")
+	if err != nil {
+		t.Fatalf("No actor to test with: %s", err)
+	}
+	room := a.Room()
+	var out bytes.Buffer
+
+	e.dropLink(a.Id)
+	if !a.LinkDead || !room.HasActor(a) {
+		t.Fatal("Expected a dropped actor to stay in the room, link-dead")
+	}
+	e.rejoin(a.Id, &out)
+	if a.LinkDead || !strings.Contains(out.String(), "reconnected") {
+		t.Errorf("Expected reconnecting to revive the actor, got '%s'", out.String())
+	}
+
+	e.dropLink(a.Id)
+	e.reapLinkDead(time.Now())
+	if !room.HasActor(a) {
+		t.Fatal("Expected the actor to stay until the timeout")
+	}
+	e.reapLinkDead(time.Now().Add(e.config.LinkDeadTimeout + time.Second))
+	if room.HasActor(a) || a.LinkDead {
+		t.Fatal("Expected the actor to be removed after the timeout")
+	}
+	e.rejoin(a.Id, &out)
+	if a.Room() != room || !room.HasActor(a) {
+		t.Error("Expected logging back in to return the actor to where it was")
+	}
+}
+
+func TestBusy(t *testing.T) {
+	e := newTestEngine(t)
+	a, err := e.zoneMgr.FindActor("A1")
+	if err != nil {
+		t.Fatalf("No actor to test with: %s", err)
+	}
+	a.Exert(3)
+	if !e.busy(a.Id) || !e.busy(a.Id) {
+		t.Fatal("Expected the actor to be busy for two more ticks")
+	}
+	if e.busy(a.Id) || a.Busy != 0 {
+		t.Errorf("Expected the actor to be free to act again, busy for %d", a.Busy)
+	}
+}
+
+func TestTravel(t *testing.T) {
+	e := newTestEngine(t)
+	a, err := e.zoneMgr.FindActor("A1")
+	if err != nil {
+		t.Fatalf("No actor to test with: %s", err)
+	}
+	from := a.Room()
+	to := a.Zone.GetRoom(entity.Id("R2"))
+	out := &bytes.Buffer{}
+	e.reqsByActor[a.Id] = []Request{}
+	e.travelling[a.Id] = out
+	a.Travel(to, 3)
+	for tick := 1; tick < 3; tick++ {
+		e.processRequests(Heartbeat{tick: tick})
+		if a.Room() != from {
+			t.Fatalf("Expected the actor to still be on its way at tick %d", tick)
+		}
+	}
+	e.processRequests(Heartbeat{tick: 3})
+	if a.Room() != to || a.Heading != nil {
+		t.Errorf("Expected the actor to have arrived after three ticks, but it's in %s", a.Room().Id)
+	}
+	if !strings.Contains(out.String(), to.Title) {
+		t.Errorf("Expected to be shown the room on arrival, got '%s'", out.String())
+	}
+}
+
+func TestQuit(t *testing.T) {
+	e := newTestEngine(t)
+	go e.Run()
+	defer e.TriggerShutdown()
+	a, err := e.zoneMgr.FindActor("A1")
+	if err != nil {
+		t.Fatalf("No actor to test with: %s", err)
+	}
+	room := a.Room()
+	p := entity.NewPlayer()
+	p.ActorId = a.Id
+	e.MessageCh <- NewMessage(Connect, p, io.Discard)
+	e.MessageCh <- NewMessage(Quit, p, nil)
+	// once the engine has moved on to the next message, it's dealt with the quit
+	e.MessageCh <- NewMessage(Connect, entity.NewPlayer(), io.Discard)
+	if room.HasActor(a) || a.LinkDead {
+		t.Error("Expected quitting to take the actor out of the world straight away")
+	}
+	e.MessageCh <- NewMessage(Connect, p, io.Discard)
+	e.MessageCh <- NewMessage(Connect, entity.NewPlayer(), io.Discard)
+	if !room.HasActor(a) {
+		t.Error("Expected logging back in to return the actor to where it was")
+	}
+}
+
+// useScriptFile Point the engine's reloads at a script file with src in it, for the rest of the test.
+func useScriptFile(t *testing.T, src string) {
+	f := filepath.Join(t.TempDir(), "commands.lua")
+	if err := os.WriteFile(f, []byte(src), 0o644); err != nil {
+		t.Fatalf("Unable to write test script: %s", err)
+	}
+	old := LuaEntrypoint
+	LuaEntrypoint = f
+	t.Cleanup(func() { LuaEntrypoint = old })
+}
+
+// connectActor Connect a player playing the actor, at role.
+func connectActor(e *Engine, id entity.Id, role entity.Role) entity.Player {
+	p := entity.NewPlayer()
+	p.ActorId = id
+	p.Role = role
+	e.MessageCh <- NewMessage(Connect, p, io.Discard)
+	return p
+}
+
+// tick Run a tick, and wait for the engine to finish it.
+func tick(e *Engine, n int) {
+	e.HeartbeatCh <- Heartbeat{tick: n}
+	e.MessageCh <- NewMessage(Connect, entity.NewPlayer(), io.Discard)
+}
+
+func TestReloadBrokenScripts(t *testing.T) {
+	e := newTestEngine(t)
+	go e.Run()
+	defer e.TriggerShutdown()
+	useScriptFile(t, "function look(req)\n req:Write(")
+	before := e.scripts
+
+	admin := connectActor(e, "A1", entity.RoleAdmin)
+	var out bytes.Buffer
+	e.RequestCh <- NewRequest(admin, &out, "reload")
+	tick(e, 1)
+	if !strings.Contains(out.String(), "Reload failed, keeping the old scripts") {
+		t.Errorf("Expected the admin to be told the reload failed, got '%s'", out.String())
+	}
+	out.Reset()
+	e.RequestCh <- NewRequest(admin, &out, "look")
+	tick(e, 2)
+	if e.scripts != before || !strings.Contains(out.String(), "This is an empty room") {
+		t.Errorf("Expected the old scripts to carry on working, got '%s'", out.String())
+	}
+}
+
+func TestReloadAfterTick(t *testing.T) {
+	e := newTestEngine(t)
+	go e.Run()
+	defer e.TriggerShutdown()
+	src, err := os.ReadFile(LuaEntrypoint)
+	if err != nil {
+		t.Fatalf("Unable to read the scripts: %s", err)
+	}
+	useScriptFile(t, string(src)+"\nfunction look(req) req:Write(\"the new look\") end\n")
+
+	// someone else looks in the same tick as the reload
+	z, _ := e.zoneMgr.GetZone("1")
+	other, err := e.zoneMgr.CreateActor(z, "Onlooker", "", entity.Stats{}, z.GetRoom("R1"))
+	if err != nil {
+		t.Fatalf("CreateActor returned an error: %s", err)
+	}
+	admin := connectActor(e, "A1", entity.RoleAdmin)
+	onlooker := connectActor(e, other.Id, entity.RolePlayer)
+	var reload, look bytes.Buffer
+	e.RequestCh <- NewRequest(admin, &reload, "reload")
+	e.RequestCh <- NewRequest(onlooker, &look, "look")
+	tick(e, 1)
+	if !strings.Contains(reload.String(), "take effect next tick") {
+		t.Fatalf("Expected the reload to compile, got '%s'", reload.String())
+	}
+	if strings.Contains(look.String(), "the new look") {
+		t.Error("Expected the new scripts not to be used until the tick was over")
+	}
+	look.Reset()
+	e.RequestCh <- NewRequest(onlooker, &look, "look")
+	tick(e, 2)
+	if !strings.Contains(look.String(), "the new look") {
+		t.Errorf("Expected the new scripts after the tick, got '%s'", look.String())
+	}
+}
@@ -5,7 +5,6 @@ import (
 	"errors"
 	"fmt"
 	"log"
-	"strings"
 
 	_ "github.com/mattn/go-sqlite3"
 )
@@ -20,6 +19,13 @@ const (
 	LoginStateFailed                      // previous creds were invalid, we're starting over
 	LoginStateMaxFailed                   // player has failed login too many times
 	LoginStateLoggedIn                    // player has successfully logged in
+	LoginStateNewUser                     // registering: waiting for the new username
+	LoginStateNewPwd                      // registering: waiting for the new password
+	LoginStateConfirmPwd                  // registering: waiting for the password again
+	LoginStateCharName                    // creating a character: waiting for its name
+	LoginStateCharDesc                    // creating a character: waiting for its description
+	LoginStateCharStats                   // creating a character: allocating stats
+	LoginStateUsurp                       // already logged in elsewhere: asking whether to take over
 )
 
 // A Stats is a structure for holding the attributes of an actor.
@@ -32,6 +38,22 @@ type Stats struct {
 	Mind   Attrib
 }
 
+// An actor can carry this much weight for each point of Str
+const strCarry = 5
+
+// ErrTooMuch Picking something up would take an actor over its Capacity.
+var ErrTooMuch = errors.New("you can't carry that much")
+
+// An Encumbrance is how weighed down an actor is by what it's carrying.
+type Encumbrance int
+
+const (
+	Unencumbered Encumbrance = iota // carrying up to half what it can
+	Burdened                        // up to three quarters
+	Encumbered                      // up to all it can
+	Overloaded                      // more than it can, say because its Str has dropped
+)
+
 // An Actor is an entity that can perform actions.
 // Actors may be players, or they may be NPCs/MOBs.
 // The Actor structure contains information about the actor's identity
@@ -46,6 +68,9 @@ type Actor struct {
 	Stats  Stats  //
 	Zone   *Zone   // The current zone for this actor, if any
 	Player Player // The player, if any, associated with this actor
+	LinkDead bool  // whether the player has lost their connection, leaving the actor here for a while
+	Busy   int     // ticks to go before the actor can act again
+	Heading *Room  // the room it's on its way to, if it's taking more than a tick to get there
 	dirty  bool    // whether the actor has been modified from initial state
 }
 
@@ -85,9 +110,67 @@ func (a *Actor) GetTitle() string {
 }
 
 // Accept Will this actor accept possession of supplied object?
-func (a *Actor) Accept(_ Thing) bool {
-	// TODO: check carrying capacity but for now can carry anything
-	return true
+func (a *Actor) Accept(thing *Thing) bool {
+	return a.CanCarry(thing) == nil
+}
+
+// CanCarry Check whether the actor could pick the thing up, and if not, why not.
+// Something it's already carrying, say in a bag, doesn't add anything.
+func (a *Actor) CanCarry(thing *Thing) error {
+	if a.Body.Holds(thing) {
+		return nil
+	}
+	if thing.Has(FlagNoTake) {
+		return ErrNoTake
+	}
+	if a.Carried()+thing.TotalWeight() > a.Capacity() {
+		return ErrTooMuch
+	}
+	return nil
+}
+
+// Carried The weight of everything the actor has, including what's inside it.
+func (a *Actor) Carried() int {
+	return a.Body.Load()
+}
+
+// Capacity The most weight the actor can carry.
+func (a *Actor) Capacity() int {
+	return a.Stats.Str.Cur * strCarry
+}
+
+// Encumbrance How weighed down the actor is.
+func (a *Actor) Encumbrance() Encumbrance {
+	carried, capacity := a.Carried(), a.Capacity()
+	switch {
+	case carried*2 <= capacity:
+		return Unencumbered
+	case carried*4 <= capacity*3:
+		return Burdened
+	case carried <= capacity:
+		return Encumbered
+	}
+	return Overloaded
+}
+
+// MoveTicks How many ticks it takes the actor to walk from one room to the next.
+// The more it's carrying, the longer it takes.
+func (a *Actor) MoveTicks() int {
+	return 1 + int(a.Encumbrance())
+}
+
+// Exert Have the actor spend ticks ticks on what it's just done, this one
+// included, so it can't act again until they've passed.
+func (a *Actor) Exert(ticks int) {
+	if ticks > 1 {
+		a.Busy = ticks - 1
+	}
+}
+
+// Travel Set off for room, arriving once ticks ticks have passed.
+func (a *Actor) Travel(room *Room, ticks int) {
+	a.Heading = room
+	a.Exert(ticks)
 }
 
 // Room Return object holding position of actor within the object hierarchy.
@@ -97,18 +180,15 @@ func (a *Actor) Room() *Room {
 	return a.Zone.GetRoom(a.Body.ParentId)
 }
 
-// Match Determine how closely a word matches the title of this actor.
+// Match Determine how closely a word matches the names of this actor.
+// Like the title, they come from the body.
 func (a *Actor) Match(word string) MatchLevel {
-	if a.GetTitle() == word {
-		return MatchExact
-	}
-	if strings.HasPrefix(a.GetTitle(), word) {
-		return MatchPrimary
-	}
-	if strings.Contains(a.GetTitle(), word) {
-		return MatchPartial
-	}
-	return MatchNone
+	return a.Body.Match(word)
+}
+
+// MatchWords Determine how closely some words match the names of this actor.
+func (a *Actor) MatchWords(words []string) MatchLevel {
+	return a.Body.MatchWords(words)
 }
 
 // Find Search actor's inventory to see if it contains an object that matches this word.
@@ -129,6 +209,16 @@ func (a *Actor) Find(word string) interface{} {
 	return bestMatch.thing
 }
 
+// FindAll Search the actor's inventory for everything that matches the words as well as anything does.
+func (a *Actor) FindAll(words []string) []interface{} {
+	found := []interface{}{}
+	things, _ := bestMatches(a.Body.Contents, words)
+	for _, thing := range things {
+		found = append(found, thing)
+	}
+	return found
+}
+
 // Take Attempt to place a thing in the actor's inventory.
 // Returns whether the attempt succeeded.
 func (a *Actor) Take(thing *Thing) bool {
@@ -138,6 +228,9 @@ func (a *Actor) Take(thing *Thing) bool {
 // Drop Attempt to drop something from the actor's inventory into the current room.
 // Returns whether the attempt succeeded.
 func (a *Actor) Drop(thing *Thing) bool {
+	if thing.Has(FlagNoDrop) {
+		return false
+	}
 	room := a.Room()
 	thing.ParentId = room.Id
 	if a.Body.Remove(thing) {
@@ -148,6 +241,15 @@ func (a *Actor) Drop(thing *Thing) bool {
 	return false
 }
 
+// Put Attempt to put something in a container.
+// Returns why it wouldn't go, if it didn't.
+func (a *Actor) Put(thing *Thing, container *Thing) error {
+	if thing.Has(FlagNoDrop) {
+		return ErrNoDrop
+	}
+	return a.Zone.PutThing(thing, container)
+}
+
 // Insert Unconditionally add something to the actor's inventory.
 func (a *Actor) Insert(child *Thing) {
 	a.Body.Insert(child)
@@ -45,3 +45,37 @@ func TestSaveLoadActor(t *testing.T) {
 	}
 	
 }
+
+func TestCarrying(t *testing.T) {
+	actor := NewActor("A9", Player{})
+	actor.Stats.Str = Attrib{10, 10}
+	bag := &Thing{Id: "T20", Title: "bag", Flags: FlagContainer, Weight: Attrib{1, 1}, Size: Attrib{5, 5}}
+	rock := &Thing{Id: "T21", Title: "rock", Weight: Attrib{24, 24}, Size: Attrib{1, 1}}
+	pebble := &Thing{Id: "T22", Title: "pebble", Weight: Attrib{2, 2}, Size: Attrib{1, 1}}
+	boulder := &Thing{Id: "T23", Title: "boulder", Weight: Attrib{51, 51}, Size: Attrib{30, 30}}
+
+	if actor.Capacity() != 50 || actor.MoveTicks() != 1 {
+		t.Fatalf("Expected Str 10 to carry 50 and walk freely, got %d and %d", actor.Capacity(), actor.MoveTicks())
+	}
+	if err := actor.CanCarry(boulder); err != ErrTooMuch {
+		t.Errorf("Expected a boulder to be too much, got %v", err)
+	}
+	actor.Insert(bag)
+	bag.Insert(pebble)
+	actor.Insert(rock)
+	if actor.Carried() != 27 || actor.Encumbrance() != Burdened || actor.MoveTicks() != 2 {
+		t.Errorf("Expected carrying 27 of 50 to be burdened, got %d, %d", actor.Carried(), actor.Encumbrance())
+	}
+	if !actor.Accept(pebble) {
+		t.Error("Expected taking the pebble out of the bag not to add anything")
+	}
+	actor.Stats.Str.Cur = 5
+	if actor.Encumbrance() != Overloaded || actor.Accept(&Thing{Weight: Attrib{1, 1}}) {
+		t.Error("Expected losing Str to leave the actor overloaded, unable to take any more")
+	}
+
+	actor.Exert(actor.MoveTicks())
+	if actor.Busy != 3 {
+		t.Errorf("Expected an overloaded move to keep the actor busy for 3 more ticks, got %d", actor.Busy)
+	}
+}
@@ -0,0 +1,167 @@
+package entity
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// A Slot is a place on an actor where it can wear or wield something.
+type Slot int
+
+const (
+	SlotNone Slot = iota // not equipped
+	SlotHead
+	SlotNeck
+	SlotBody
+	SlotArms
+	SlotHands
+	SlotWaist
+	SlotLegs
+	SlotFeet
+	SlotMainHand
+	SlotOffHand
+)
+
+var slotNames = []string{"", "head", "neck", "body", "arms", "hands", "waist", "legs", "feet", "main hand", "off hand"}
+
+// Slots Every slot, in the order equipment is listed.
+var Slots = []Slot{SlotHead, SlotNeck, SlotBody, SlotArms, SlotHands, SlotWaist, SlotLegs, SlotFeet, SlotMainHand, SlotOffHand}
+
+// Reasons an actor can't wear, wield or unequip something.
+var (
+	ErrNotCarried   = errors.New("you aren't carrying it")
+	ErrNotWearable  = errors.New("you can't wear that")
+	ErrNotWieldable = errors.New("you can't wield that")
+	ErrInUse        = errors.New("you're already using it")
+	ErrSlotTaken    = errors.New("you're already wearing something there")
+	ErrHandsFull    = errors.New("your hands are full")
+	ErrNotEquipped  = errors.New("you aren't using it")
+)
+
+func (s Slot) String() string {
+	if s < 0 || int(s) >= len(slotNames) {
+		return fmt.Sprintf("Slot(%d)", int(s))
+	}
+	return slotNames[s]
+}
+
+// ParseSlot Look up a slot by name. An empty name is SlotNone.
+func ParseSlot(name string) (Slot, error) {
+	for i, n := range slotNames {
+		if strings.EqualFold(name, n) {
+			return Slot(i), nil
+		}
+	}
+	return SlotNone, fmt.Errorf("there's no slot called '%s'", name)
+}
+
+// IsWearable Whether the thing can be worn, and has somewhere to be worn.
+func (t *Thing) IsWearable() bool {
+	return t.Has(FlagWearable) && t.WearOn != SlotNone
+}
+
+// IsWieldable Whether the thing can be held in the hand and used.
+func (t *Thing) IsWieldable() bool {
+	return t.Has(FlagWieldable)
+}
+
+// IsEquipped Whether someone is wearing or wielding the thing.
+func (t *Thing) IsEquipped() bool {
+	return t.Slot != SlotNone
+}
+
+// Equipped What the actor has in a slot, if anything.
+func (a *Actor) Equipped(slot Slot) *Thing {
+	for _, thing := range a.Body.Contents {
+		if thing.Slot == slot {
+			return thing
+		}
+	}
+	return nil
+}
+
+// Equipment Everything the actor is wearing or wielding, in slot order.
+func (a *Actor) Equipment() []*Thing {
+	things := []*Thing{}
+	for _, slot := range Slots {
+		if thing := a.Equipped(slot); thing != nil {
+			things = append(things, thing)
+		}
+	}
+	return things
+}
+
+// Carrying Everything the actor has that it isn't wearing or wielding.
+func (a *Actor) Carrying() []*Thing {
+	things := []*Thing{}
+	for _, thing := range a.Body.Contents {
+		if !thing.IsEquipped() {
+			things = append(things, thing)
+		}
+	}
+	return things
+}
+
+// Wear Put on something the actor is carrying, in the slot it's made for.
+// Returns why not, if it can't.
+func (a *Actor) Wear(thing *Thing) error {
+	if err := a.canEquip(thing); err != nil {
+		return err
+	}
+	if !thing.IsWearable() {
+		return ErrNotWearable
+	}
+	if a.Equipped(thing.WearOn) != nil {
+		return ErrSlotTaken
+	}
+	a.equip(thing, thing.WearOn)
+	return nil
+}
+
+// Wield Take something the actor is carrying in hand, the main hand if it's free
+// and otherwise the off hand. Returns why not, if it can't.
+func (a *Actor) Wield(thing *Thing) error {
+	if err := a.canEquip(thing); err != nil {
+		return err
+	}
+	if !thing.IsWieldable() {
+		return ErrNotWieldable
+	}
+	for _, slot := range []Slot{SlotMainHand, SlotOffHand} {
+		if a.Equipped(slot) == nil {
+			a.equip(thing, slot)
+			return nil
+		}
+	}
+	return ErrHandsFull
+}
+
+// Unequip Stop wearing or wielding something, leaving it in the actor's inventory.
+// Cursed things won't come off.
+func (a *Actor) Unequip(thing *Thing) error {
+	if thing.ParentId != a.Body.Id || !thing.IsEquipped() {
+		return ErrNotEquipped
+	}
+	if thing.Has(FlagCursed) {
+		return ErrCursed
+	}
+	a.equip(thing, SlotNone)
+	return nil
+}
+
+// canEquip Check the actor is carrying the thing, and not already using it.
+func (a *Actor) canEquip(thing *Thing) error {
+	if thing.ParentId != a.Body.Id {
+		return ErrNotCarried
+	}
+	if thing.IsEquipped() {
+		return ErrInUse
+	}
+	return nil
+}
+
+func (a *Actor) equip(thing *Thing, slot Slot) {
+	thing.Slot = slot
+	thing.dirty = true
+}
@@ -0,0 +1,70 @@
+package entity
+
+import "testing"
+
+func TestEquipment(t *testing.T) {
+	actor := NewActor("A9", Player{})
+	actor.Body.Id = "T30"
+	helmet := &Thing{Id: "T31", Title: "helmet", Flags: FlagWearable, WearOn: SlotHead}
+	hat := &Thing{Id: "T32", Title: "hat", Flags: FlagWearable, WearOn: SlotHead}
+	sword := &Thing{Id: "T33", Title: "sword", Flags: FlagWieldable}
+	dagger := &Thing{Id: "T34", Title: "dagger", Flags: FlagWieldable}
+	club := &Thing{Id: "T35", Title: "club", Flags: FlagWieldable}
+	for _, thing := range []*Thing{helmet, hat, sword, dagger, club} {
+		actor.Insert(thing)
+	}
+
+	if err := actor.Wear(&Thing{Flags: FlagWearable, WearOn: SlotFeet}); err != ErrNotCarried {
+		t.Errorf("Expected not to be able to wear something not carried, got %v", err)
+	}
+	if err := actor.Wear(sword); err != ErrNotWearable {
+		t.Errorf("Expected not to be able to wear a sword, got %v", err)
+	}
+	if err := actor.Wear(helmet); err != nil || actor.Equipped(SlotHead) != helmet {
+		t.Fatalf("Expected to wear the helmet on the head, got %v", err)
+	}
+	if err := actor.Wear(helmet); err != ErrInUse {
+		t.Errorf("Expected the helmet to be in use already, got %v", err)
+	}
+	if err := actor.Wear(hat); err != ErrSlotTaken {
+		t.Errorf("Expected no room for a hat on top of the helmet, got %v", err)
+	}
+	if err := actor.Wield(hat); err != ErrNotWieldable {
+		t.Errorf("Expected not to be able to wield a hat, got %v", err)
+	}
+
+	actor.Wield(sword)
+	actor.Wield(dagger)
+	if sword.Slot != SlotMainHand || dagger.Slot != SlotOffHand {
+		t.Errorf("Expected the sword in the main hand and the dagger in the off hand, got %s and %s", sword.Slot, dagger.Slot)
+	}
+	if err := actor.Wield(club); err != ErrHandsFull {
+		t.Errorf("Expected no hand free for the club, got %v", err)
+	}
+	equipment, carrying := actor.Equipment(), actor.Carrying()
+	if len(equipment) != 3 || equipment[0] != helmet || equipment[2] != dagger || len(carrying) != 2 {
+		t.Errorf("Expected three things in use and two carried, got %d and %d", len(equipment), len(carrying))
+	}
+
+	if err := actor.Unequip(sword); err != nil || sword.IsEquipped() {
+		t.Errorf("Expected to stop wielding the sword, got %v", err)
+	}
+	if err := actor.Unequip(sword); err != ErrNotEquipped {
+		t.Errorf("Expected the sword not to be in use any more, got %v", err)
+	}
+	actor.Remove(helmet)
+	if helmet.IsEquipped() {
+		t.Error("Expected the helmet to stop being worn once it's gone")
+	}
+}
+
+func TestParseSlot(t *testing.T) {
+	for name, want := range map[string]Slot{"": SlotNone, "head": SlotHead, "Main Hand": SlotMainHand} {
+		if slot, err := ParseSlot(name); err != nil || slot != want {
+			t.Errorf("Expected '%s' to be %s, got %s (%v)", name, want, slot, err)
+		}
+	}
+	if _, err := ParseSlot("tail"); err == nil {
+		t.Error("Expected there to be no tail slot")
+	}
+}
@@ -0,0 +1,134 @@
+package entity
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ThingFlags Bit flags indicating state or features on a thing.
+// They're stored by name, so the bits can be rearranged.
+type ThingFlags int
+
+const (
+	FlagContainer ThingFlags = 1 << iota // other things can be put in it
+	FlagWearable                         // it can be worn, in its WearOn slot
+	FlagWieldable                        // it can be held in the hand and used
+	FlagNoTake                           // it can't be picked up
+	FlagNoDrop                           // whoever has it can't let go of it
+	FlagHidden                           // it's there, but nobody notices it
+	FlagInvisible                        // it's there, but nobody can see it
+	FlagLight                            // it gives off light
+	FlagClosed                           // it's a container with its lid shut
+	FlagLocked                           // it's closed, and won't open without a key
+	FlagMagical                          // there's magic in it
+	FlagCursed                           // once worn or wielded, it won't come off
+)
+
+// The name of each flag, in bit order
+var flagNames = []string{"container", "wearable", "wieldable", "notake", "nodrop", "hidden",
+	"invisible", "light", "closed", "locked", "magical", "cursed"}
+
+// Errors for when a flag stops something being taken, dropped, put in or taken off.
+var (
+	ErrNoTake = errors.New("it won't budge")
+	ErrNoDrop = errors.New("you can't let go of it")
+	ErrClosed = errors.New("it's closed")
+	ErrCursed = errors.New("it won't come off")
+)
+
+// FlagNamed Look up a flag by name.
+func FlagNamed(name string) (ThingFlags, error) {
+	for i, n := range flagNames {
+		if strings.EqualFold(name, n) {
+			return 1 << i, nil
+		}
+	}
+	return 0, fmt.Errorf("there's no flag called '%s'", name)
+}
+
+// ParseFlags Read flags from their names, separated by spaces, e.g. "container closed".
+// A plain number is taken as the bits themselves, as older worlds stored them.
+func ParseFlags(s string) (ThingFlags, error) {
+	flags, unknown := parseFlagNames(s)
+	if len(unknown) > 0 {
+		return flags, fmt.Errorf("there's no flag called '%s'", unknown[0])
+	}
+	return flags, nil
+}
+
+// parseFlagNames Read flags like ParseFlags, but carry on past names that aren't
+// flags, returning them as well so they needn't be lost.
+func parseFlagNames(s string) (ThingFlags, []string) {
+	if n, err := strconv.Atoi(s); err == nil {
+		return ThingFlags(n), nil
+	}
+	var flags ThingFlags
+	var unknown []string
+	for _, name := range strings.Fields(s) {
+		if flag, err := FlagNamed(name); err == nil {
+			flags |= flag
+		} else {
+			unknown = append(unknown, name)
+		}
+	}
+	return flags, unknown
+}
+
+// Names The names of the flags that are set.
+func (f ThingFlags) Names() []string {
+	names := []string{}
+	for i, name := range flagNames {
+		if f&(1<<i) != 0 {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func (f ThingFlags) String() string {
+	return strings.Join(f.Names(), " ")
+}
+
+// MarshalYAML Write the flags as a list of names.
+func (f ThingFlags) MarshalYAML() (interface{}, error) {
+	return f.Names(), nil
+}
+
+// UnmarshalYAML Read the flags from a list of names, or a string of them.
+func (f *ThingFlags) UnmarshalYAML(node *yaml.Node) error {
+	var names []string
+	if node.Kind == yaml.SequenceNode {
+		if err := node.Decode(&names); err != nil {
+			return err
+		}
+	} else {
+		names = strings.Fields(node.Value)
+	}
+	flags, err := ParseFlags(strings.Join(names, " "))
+	if err != nil {
+		return err
+	}
+	*f = flags
+	return nil
+}
+
+// Has Whether all the given flags are set on the thing.
+func (t *Thing) Has(flags ThingFlags) bool {
+	return t.Flags&flags == flags
+}
+
+// HasFlag Whether the named flag is set on the thing. This is for scripts,
+// e.g. if thing:HasFlag("notake") then ... end
+func (t *Thing) HasFlag(name string) bool {
+	flag, err := FlagNamed(name)
+	return err == nil && t.Has(flag)
+}
+
+// Visible Whether people can see the thing, say when they look around.
+func (t *Thing) Visible() bool {
+	return t.Flags&(FlagHidden|FlagInvisible) == 0
+}
@@ -0,0 +1,107 @@
+package entity
+
+import (
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestParseFlags(t *testing.T) {
+	flags, err := ParseFlags("container Closed")
+	if err != nil || flags != FlagContainer|FlagClosed {
+		t.Errorf("Expected a closed container, got %v (%v)", flags.Names(), err)
+	}
+	if flags.String() != "container closed" {
+		t.Errorf("Expected the flags to be written by name, got '%s'", flags)
+	}
+	if flags, _ := ParseFlags("5"); flags != FlagContainer|FlagWieldable {
+		t.Errorf("Expected flags stored as a number to still load, got %v", flags.Names())
+	}
+	if flags, _ := ParseFlags(""); flags != 0 {
+		t.Errorf("Expected no flags, got %v", flags.Names())
+	}
+	if _, err := ParseFlags("container sticky"); err == nil {
+		t.Error("Expected an unknown flag to be an error")
+	}
+}
+
+func TestFlagsYAML(t *testing.T) {
+	var thing struct {
+		Flags ThingFlags
+	}
+	if err := yaml.Unmarshal([]byte("flags: [notake, hidden]"), &thing); err != nil || thing.Flags != FlagNoTake|FlagHidden {
+		t.Fatalf("Expected a list of flag names to load, got %v (%v)", thing.Flags.Names(), err)
+	}
+	if err := yaml.Unmarshal([]byte("flags: light magical"), &thing); err != nil || thing.Flags != FlagLight|FlagMagical {
+		t.Errorf("Expected a string of flag names to load, got %v (%v)", thing.Flags.Names(), err)
+	}
+	if err := yaml.Unmarshal([]byte("flags: [shiny]"), &thing); err == nil {
+		t.Error("Expected an unknown flag to be an error")
+	}
+	out, _ := yaml.Marshal(thing)
+	if string(out) != "flags:\n    - light\n    - magical\n" {
+		t.Errorf("Expected the flags to be written by name, got '%s'", out)
+	}
+}
+
+func TestFlagRules(t *testing.T) {
+	actor := NewActor("A9", Player{})
+	actor.Body.Id = "T40"
+	actor.Stats.Str = Attrib{10, 10}
+	statue := &Thing{Id: "T41", Title: "statue", Flags: FlagNoTake}
+	ring := &Thing{Id: "T42", Title: "ring", Flags: FlagWearable | FlagCursed | FlagNoDrop, WearOn: SlotHands}
+	chest := &Thing{Id: "T43", Title: "chest", Flags: FlagContainer | FlagClosed, Weight: Attrib{5, 5}, Size: Attrib{10, 10}}
+
+	if err := actor.CanCarry(statue); err != ErrNoTake {
+		t.Errorf("Expected a notake statue to stay put, got %v", err)
+	}
+	if err := chest.CanHold(ring); err != ErrClosed {
+		t.Errorf("Expected nothing to go in a closed chest, got %v", err)
+	}
+	if err := (&Thing{Flags: FlagContainer | FlagLocked, Size: Attrib{10, 10}}).CanHold(ring); err != ErrClosed {
+		t.Errorf("Expected nothing to go in a locked chest, got %v", err)
+	}
+	if !statue.HasFlag("NoTake") || statue.HasFlag("cursed") || statue.HasFlag("sticky") {
+		t.Error("Expected HasFlag to check flags by name")
+	}
+	if (&Thing{Flags: FlagHidden}).Visible() || !statue.Visible() {
+		t.Error("Expected hidden things not to be visible")
+	}
+
+	actor.Insert(ring)
+	if err := actor.Wear(ring); err != nil {
+		t.Fatalf("Expected to put the ring on, got %s", err)
+	}
+	if err := actor.Unequip(ring); err != ErrCursed || !ring.IsEquipped() {
+		t.Errorf("Expected a cursed ring not to come off, got %v", err)
+	}
+	if err := actor.Put(ring, chest); err != ErrNoDrop {
+		t.Errorf("Expected not to be able to let go of a nodrop ring, got %v", err)
+	}
+}
+
+func TestUnknownFlagsAreKept(t *testing.T) {
+	zm := tempZoneMgr(t)
+	z, _ := zm.GetZone(Id("1"))
+	if _, err := z.db.Exec(`INSERT INTO thing (id, attributes, title, description, location, flags) VALUES ('T90', '1:1,1:1,1:1', 'box', '', 'R1', 'container sticky closed')`); err != nil {
+		t.Fatalf("Unable to add a thing: %s", err)
+	}
+	box := LoadThings(z.db)["T90"]
+	if box == nil {
+		t.Fatal("Expected the box to load")
+	}
+	if box.Flags != FlagContainer|FlagClosed {
+		t.Errorf("Expected the known flags to load, got %v", box.Flags.Names())
+	}
+	box.dirty = true
+	if err := box.Save(z.db); err != nil {
+		t.Fatalf("Save returned an error: %s", err)
+	}
+	var flags string
+	if err := z.db.QueryRow(`SELECT flags FROM thing WHERE id = 'T90'`).Scan(&flags); err != nil {
+		t.Fatalf("Unable to read the box back: %s", err)
+	}
+	if flags != "container closed sticky" {
+		t.Errorf("Expected the unknown flag to be saved again, got '%s'", flags)
+	}
+}
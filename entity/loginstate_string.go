@@ -14,11 +14,18 @@ func _() {
 	_ = x[LoginStateFailed-3]
 	_ = x[LoginStateMaxFailed-4]
 	_ = x[LoginStateLoggedIn-5]
+	_ = x[LoginStateNewUser-6]
+	_ = x[LoginStateNewPwd-7]
+	_ = x[LoginStateConfirmPwd-8]
+	_ = x[LoginStateCharName-9]
+	_ = x[LoginStateCharDesc-10]
+	_ = x[LoginStateCharStats-11]
+	_ = x[LoginStateUsurp-12]
 }
 
-const _LoginState_name = "LoginStateStartLoginStateWantUserLoginStateWantPwdLoginStateFailedLoginStateMaxFailedLoginStateLoggedIn"
+const _LoginState_name = "LoginStateStartLoginStateWantUserLoginStateWantPwdLoginStateFailedLoginStateMaxFailedLoginStateLoggedInLoginStateNewUserLoginStateNewPwdLoginStateConfirmPwdLoginStateCharNameLoginStateCharDescLoginStateCharStatsLoginStateUsurp"
 
-var _LoginState_index = [...]uint8{0, 15, 33, 50, 66, 85, 103}
+var _LoginState_index = [...]uint8{0, 15, 33, 50, 66, 85, 103, 120, 136, 156, 174, 192, 211, 226}
 
 func (i LoginState) String() string {
 	if i < 0 || i >= LoginState(len(_LoginState_index)-1) {
@@ -9,6 +9,7 @@ import (
 	"strings"
 
 	_ "github.com/mattn/go-sqlite3"
+	"rob.co/textcrawl/markup"
 )
 
 // An Id is a unique identifier.
@@ -33,7 +34,9 @@ const (
 func IdTypeForId(id Id) IdType {
 	if strings.HasPrefix(string(id), "R") {
 		return IdTypeRoom
-	} else if strings.HasPrefix(string(id), "C") {
+	} else if strings.HasPrefix(string(id), "C") || strings.HasPrefix(string(id), "T") {
+		// anything held by a thing is in a container, including what an actor
+		// carries, which is held by their body
 		return IdTypeContainer
 	} else if strings.HasPrefix(string(id), "A") {
 		return IdTypeInventory
@@ -41,8 +44,17 @@ func IdTypeForId(id Id) IdType {
 	return IdTypeUnknown
 }
 
-// ThingFlags Bit flags indicating state or features on a thing.
-type ThingFlags int
+// A container can hold this many times its own weight
+const containerStrength = 10
+
+// Reasons a container won't take something, from CanHold.
+var (
+	ErrNotContainer = errors.New("it isn't a container")
+	ErrInsideItself = errors.New("it would be inside itself")
+	ErrTooBig       = errors.New("it's too big to fit")
+	ErrFull         = errors.New("there isn't enough room left")
+	ErrTooHeavy     = errors.New("it's too heavy")
+)
 
 // MatchLevel A type for specifying how close a match has matched.
 // We use this for looking up what objects words refer to.
@@ -81,6 +93,10 @@ type Thing struct {
 	Contents   []*Thing
 	ParentId   Id
 	Flags      ThingFlags
+	Keywords   []string // what players can call it. If empty, the words of its title are used
+	WearOn     Slot     // where it goes when it's worn, for wearable things
+	Slot       Slot     // where the actor carrying it is wearing or wielding it, if they are
+	otherFlags []string // flag names that aren't known here, kept so saving doesn't lose them
 	dirty      bool
 }
 
@@ -98,24 +114,152 @@ func (t *Thing) ID() Id {
 }
 
 // Accept Determine whether the supplied thing can be contained within this thing.
-func (t *Thing) Accept(_ *Thing) bool {
-	// TODO: later this will actually check capacity
-	// but for now, anything can go in anything
-	return true
+func (t *Thing) Accept(child *Thing) bool {
+	return t.CanHold(child) == nil
+}
+
+// CanHold Check whether the thing could be put in this one, and if not, why not.
+// A container holds things smaller than itself, up to its own size in total and
+// containerStrength times its own weight.
+func (t *Thing) CanHold(child *Thing) error {
+	switch {
+	case !t.IsContainer():
+		return ErrNotContainer
+	case t.IsClosed():
+		return ErrClosed
+	case child == t || child.Holds(t):
+		return ErrInsideItself
+	case child.Size.Cur >= t.Size.Cur:
+		return ErrTooBig
+	case t.contentSize()+child.Size.Cur > t.Size.Cur:
+		return ErrFull
+	case t.Load()+child.TotalWeight() > t.Weight.Cur*containerStrength:
+		return ErrTooHeavy
+	}
+	return nil
+}
+
+// IsContainer Whether other things can be put in this one.
+func (t *Thing) IsContainer() bool {
+	return t.Has(FlagContainer)
+}
+
+// IsClosed Whether the thing is shut, so nothing can be seen in, put in or taken
+// out of it. Locked things are closed too.
+func (t *Thing) IsClosed() bool {
+	return t.Has(FlagClosed) || t.Has(FlagLocked)
+}
+
+// Holds Whether the thing is somewhere inside this one, however deep.
+func (t *Thing) Holds(thing *Thing) bool {
+	for _, item := range t.Contents {
+		if item == thing || item.Holds(thing) {
+			return true
+		}
+	}
+	return false
+}
+
+// TotalWeight The thing's weight along with everything in it.
+func (t *Thing) TotalWeight() int {
+	return t.Weight.Cur + t.Load()
+}
+
+// Load The weight of everything in the thing.
+func (t *Thing) Load() int {
+	load := 0
+	for _, item := range t.Contents {
+		load += item.TotalWeight()
+	}
+	return load
+}
+
+func (t *Thing) contentSize() int {
+	size := 0
+	for _, item := range t.Contents {
+		size += item.Size.Cur
+	}
+	return size
 }
 
-// Match How closely does this word match the title of this thing?
+var articles = map[string]bool{"a": true, "an": true, "the": true, "some": true}
+
+// IsArticle Whether word is "a", "the" or the like, which players type but
+// which don't help tell one thing from another.
+func IsArticle(word string) bool {
+	return articles[strings.ToLower(word)]
+}
+
+// Names The words players can use to refer to the thing: its keywords, or
+// failing that, the words of its title.
+func (t *Thing) Names() []string {
+	if len(t.Keywords) > 0 {
+		return t.Keywords
+	}
+	names := []string{}
+	for _, word := range strings.Fields(strings.ToLower(markup.Strip(t.Title))) {
+		if !IsArticle(word) {
+			names = append(names, word)
+		}
+	}
+	return names
+}
+
+// Match How closely does this word, or these space separated words, match the thing's names?
 func (t *Thing) Match(word string) MatchLevel {
-	if t.Title == word {
-		return MatchExact
+	return t.MatchWords(strings.Fields(word))
+}
+
+// MatchWords How closely do these words match the thing's names? Every word has to
+// be one of them, or the start of one, so "rusty" and "rusty buck" both match
+// a rusty bucket, but "rusty knife" doesn't. Plurals match too, so "coins" is a coin.
+func (t *Thing) MatchWords(words []string) MatchLevel {
+	if len(words) == 0 {
+		return MatchNone
 	}
-	if strings.HasPrefix(t.Title, word) {
-		return MatchPrimary
+	names := t.Names()
+	level := MatchExact
+	for _, word := range words {
+		word = strings.ToLower(word)
+		best := MatchNone
+		for _, name := range names {
+			if name == word || name+"s" == word || name+"es" == word {
+				best = MatchExact
+				break
+			}
+			if strings.HasPrefix(name, word) {
+				best = MatchPrimary
+			}
+		}
+		if best < level {
+			level = best
+		}
 	}
-	if strings.Contains(t.Title, word) {
-		return MatchPartial
+	return level
+}
+
+// A matcher is anything players can refer to by name.
+type matcher interface {
+	MatchWords(words []string) MatchLevel
+}
+
+// bestMatches The items which match words as closely as the best of them does, in
+// their original order, and how closely that is.
+func bestMatches[T matcher](items []T, words []string) ([]T, MatchLevel) {
+	var found []T
+	level := MatchNone
+	for _, item := range items {
+		match := item.MatchWords(words)
+		if match == MatchNone || match < level {
+			continue
+		}
+		if match > level {
+			found = nil
+			level = match
+		}
+		found = append(found, item)
 	}
-	return MatchNone
+	return found, level
 }
 
 // Find Search the contents of this thing for something that matches the supplied word.
@@ -134,9 +278,22 @@ func (t *Thing) Find(word string) *Thing {
 	return bestMatch.thing
 }
 
+// FindAll Everything in this thing which matches the words as well as anything does.
+func (t *Thing) FindAll(words []string) []*Thing {
+	return FindAmong(t.Contents, words)
+}
+
+// FindAmong Pick out the things that match the words as well as any of them do.
+func FindAmong(things []*Thing, words []string) []*Thing {
+	found, _ := bestMatches(things, words)
+	return found
+}
+
 func (t *Thing) Insert(child *Thing) {
+	child.ParentId = t.Id
 	t.Contents = append(t.Contents, child)
 	t.dirty = true
+	child.dirty = true
 }
 
 func (t *Thing) Remove(thing *Thing) bool {
@@ -144,6 +301,9 @@ func (t *Thing) Remove(thing *Thing) bool {
 		if item == thing {
 			t.Contents = append(t.Contents[:i], t.Contents[i+1:]...)
 			t.dirty = true
+			// nobody can be wearing something they no longer have
+			thing.Slot = SlotNone
+			thing.dirty = true
 			return true
 		}
 	}
@@ -199,7 +359,7 @@ func DeserializeAttribList(attribStr string, attribs ...*Attrib) error {
 
 func LoadThings(db *sql.DB) map[Id]*Thing {
 	rows, err := db.Query(`
-SELECT id, attributes, title, description, location, flags
+SELECT id, attributes, title, description, location, flags, keywords, wear_on, slot
 FROM thing
 ORDER BY location`)
 	if err != nil {
@@ -212,9 +372,13 @@ ORDER BY location`)
 	for rows.Next() {
 		thing := NewThing()
 		var (
-			attribs string
+			attribs  string
+			flags    string
+			keywords string
+			wearOn   string
+			slot     string
 		)
-		err = rows.Scan(&thing.Id, &attribs, &thing.Title, &thing.Desc, &thing.ParentId, &thing.Flags)
+		err = rows.Scan(&thing.Id, &attribs, &thing.Title, &thing.Desc, &thing.ParentId, &flags, &keywords, &wearOn, &slot)
 		if err != nil {
 			panic(fmt.Sprintf("Error while iterating rows: %s", err))
 		}
@@ -223,6 +387,16 @@ ORDER BY location`)
 			log.Printf("Failed to deserialize attributes for object %s", thing.Id)
 			continue
 		}
+		if thing.Flags, thing.otherFlags = parseFlagNames(flags); len(thing.otherFlags) > 0 {
+			log.Printf("WARN: %s has unknown flags, which will be kept but ignored: %s", thing.Id, strings.Join(thing.otherFlags, " "))
+		}
+		thing.Keywords = strings.Fields(strings.ToLower(keywords))
+		if thing.WearOn, err = ParseSlot(wearOn); err != nil {
+			log.Printf("WARN: %s is worn on an unknown slot: %s", thing.Id, err)
+		}
+		if thing.Slot, err = ParseSlot(slot); err != nil {
+			log.Printf("WARN: %s is equipped in an unknown slot: %s", thing.Id, err)
+		}
 		things[thing.Id] = thing
 	}
 	err = rows.Err()
@@ -243,7 +417,8 @@ func (t *Thing) Save(db *sql.DB) error {
 		return nil
 	}
 	attribs := SerializeAttribList(t.Weight, t.Size, t.Durability)
-	res, err := db.Exec(`UPDATE thing SET attributes = ?, location = ?, flags =? WHERE id = ?`, attribs, t.ParentId, t.Id)
+	res, err := db.Exec(`UPDATE thing SET attributes = ?, location = ?, flags = ?, slot = ? WHERE id = ?`,
+		attribs, t.ParentId, strings.Join(append(t.Flags.Names(), t.otherFlags...), " "), t.Slot.String(), t.Id)
 	if err != nil {
 		return err
 	}
@@ -139,4 +139,81 @@ func TestLoadObjects(t *testing.T) {
 	if t2.Title != "a man" {
 		t.Errorf("expected T2 title to be 'a man' but was '%s'", t1.Title)		
 	}
+	if t3 := things["T3"]; len(t3.Keywords) != 4 || t3.Keywords[3] != "pail" {
+		t.Errorf("expected T3 to have keywords, got %v", t3.Keywords)
+	}
+	if t3 := things["T3"]; t3.Flags != FlagContainer {
+		t.Errorf("expected T3 to be a container, got %v", t3.Flags.Names())
+	}
+}
+
+func TestMatchWords(t *testing.T) {
+	bucket := &Thing{Title: "a {y}rusty{x} bucket"}
+	for words, want := range map[string]MatchLevel{
+		"bucket":       MatchExact,
+		"rusty bucket": MatchExact,
+		"rus buck":     MatchPrimary,
+		"a":            MatchNone,
+		"rusty knife":  MatchNone,
+		"pail":         MatchNone,
+	} {
+		if got := bucket.Match(words); got != want {
+			t.Errorf("Expected '%s' to match %d but got %d", words, want, got)
+		}
+	}
+	bucket.Keywords = []string{"pail", "rusty"}
+	if bucket.Match("rusty pail") != MatchExact || bucket.Match("bucket") != MatchNone {
+		t.Errorf("Expected keywords to replace the title's words, got %v", bucket.Names())
+	}
+
+	room := &Room{Things: []*Thing{
+		{Title: "tin knife"},
+		bucket,
+		{Title: "silver knife"},
+		{Title: "knifepoint"},
+	}}
+	found := room.FindAll([]string{"knife"})
+	if len(found) != 2 || found[0] != room.Things[0] || found[1] != room.Things[2] {
+		t.Errorf("Expected the two knives, got %v", found)
+	}
+}
+
+func TestCanHold(t *testing.T) {
+	bucket := &Thing{Id: "T10", Title: "bucket", Flags: FlagContainer, Weight: Attrib{2, 2}, Size: Attrib{5, 5}}
+	knife := &Thing{Id: "T11", Title: "knife", Weight: Attrib{1, 1}, Size: Attrib{2, 2}}
+	spoon := &Thing{Id: "T12", Title: "spoon", Weight: Attrib{1, 1}, Size: Attrib{2, 2}}
+	fork := &Thing{Id: "T13", Title: "fork", Weight: Attrib{1, 1}, Size: Attrib{2, 2}}
+	anvil := &Thing{Id: "T14", Title: "anvil", Weight: Attrib{50, 50}, Size: Attrib{1, 1}}
+	barrel := &Thing{Id: "T15", Title: "barrel", Flags: FlagContainer, Weight: Attrib{10, 10}, Size: Attrib{20, 20}}
+
+	if err := knife.CanHold(spoon); err != ErrNotContainer {
+		t.Errorf("Expected a knife not to be a container, got %v", err)
+	}
+	if err := bucket.CanHold(bucket); err != ErrInsideItself {
+		t.Errorf("Expected a bucket not to go in itself, got %v", err)
+	}
+	if err := bucket.CanHold(barrel); err != ErrTooBig {
+		t.Errorf("Expected a barrel not to fit in a bucket, got %v", err)
+	}
+	if err := bucket.CanHold(anvil); err != ErrTooHeavy {
+		t.Errorf("Expected an anvil to be too heavy for a bucket, got %v", err)
+	}
+	if !bucket.Accept(knife) {
+		t.Fatal("Expected a knife to go in a bucket")
+	}
+	bucket.Insert(knife)
+	bucket.Insert(spoon)
+	if knife.ParentId != bucket.Id {
+		t.Errorf("Expected the knife to know it's in the bucket, got %s", knife.ParentId)
+	}
+	if err := bucket.CanHold(fork); err != ErrFull {
+		t.Errorf("Expected a bucket with a knife and spoon to be full, got %v", err)
+	}
+	barrel.Insert(bucket)
+	if err := bucket.CanHold(barrel); err != ErrInsideItself {
+		t.Errorf("Expected a barrel not to go in the bucket inside it, got %v", err)
+	}
+	if barrel.TotalWeight() != 14 || barrel.Load() != 4 {
+		t.Errorf("Expected the barrel to weigh 14 with a load of 4, got %d and %d", barrel.TotalWeight(), barrel.Load())
+	}
 }
@@ -5,6 +5,8 @@ import (
 	"errors"
 	"fmt"
 	"path/filepath"
+	"strings"
+	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 	"golang.org/x/crypto/bcrypt"
@@ -15,6 +17,36 @@ type Player struct {
 	LoginAttempts int
 	Username      string
 	ActorId	  Id
+	Role          Role
+}
+
+// A Role says what a player is allowed to do. Each role can do everything the ones before it can.
+type Role int
+
+const (
+	RolePlayer  Role = iota // plays the game
+	RoleBuilder             // also edits the world
+	RoleAdmin               // also runs the game and manages players
+	RoleOwner               // can do anything, including making admins
+)
+
+var roleNames = []string{"player", "builder", "admin", "owner"}
+
+func (r Role) String() string {
+	if r < 0 || int(r) >= len(roleNames) {
+		return fmt.Sprintf("Role(%d)", int(r))
+	}
+	return roleNames[r]
+}
+
+// ParseRole Look up a role by name.
+func ParseRole(name string) (Role, error) {
+	for i, n := range roleNames {
+		if strings.EqualFold(name, n) {
+			return Role(i), nil
+		}
+	}
+	return RolePlayer, fmt.Errorf("There's no role called '%s'", name)
 }
 
 func NewPlayer() Player {
@@ -23,8 +55,45 @@ func NewPlayer() Player {
 	}
 }
 
+// Prefs Per-player settings for how output is displayed.
+type Prefs struct {
+	Color bool // whether to send colour to clients that can show it
+	Width int  // terminal width to wrap to. Zero means use what the client says.
+}
+
+// DefaultPrefs Settings for a player who hasn't changed anything.
+func DefaultPrefs() Prefs {
+	return Prefs{
+		Color: true,
+	}
+}
+
+// LoginFailures Recent failed logins for a username or an address (the subject).
+type LoginFailures struct {
+	Count       int       // failures since Last was within the lockout window
+	Last        time.Time // when the latest one happened
+	LockedUntil time.Time // no logins until then
+}
+
 type PlayerMgr interface {
 	LookupPlayer(username string, pwd string) (Id, error)
+	PlayerExists(username string) (bool, error)
+	CreatePlayer(username string, pwd string) error
+	SetPassword(username string, pwd string) error
+	SetActor(username string, actorId Id) error
+	LoadRole(username string) (Role, error)
+	SetRole(username string, role Role) error
+	SetActive(username string, active bool) error
+	ClearActive() error
+	LoginFailures(subject string) (LoginFailures, error)
+	SaveLoginFailures(subject string, failures LoginFailures) error
+	ClearLoginFailures(subject string) error
+	LoadPrefs(username string) (Prefs, error)
+	SavePrefs(username string, prefs Prefs) error
+	LookupPlayerKey(username string, key string) (Id, error)
+	PlayerKeys(username string) ([]string, error)
+	AddPlayerKey(username string, key string) error
+	RemovePlayerKey(username string, key string) error
 }
 
 type DBPlayerMgr struct {
@@ -42,32 +111,264 @@ func NewPlayerMgr() PlayerMgr {
 	}
 }
 
-// hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+// Limits on what we'll accept when someone registers
+const (
+	minUsernameLength = 3
+	maxUsernameLength = 16
+	minPasswordLength = 6
+)
+
+// Reasons a login can fail
+var (
+	ErrBadLogin        = errors.New("Invalid username or password")
+	ErrAlreadyLoggedIn = errors.New("User is already logged in")
+)
+
+// ErrPlayerExists is returned when registering a username that's already taken.
+var ErrPlayerExists = errors.New("That name is already taken")
+
+// Names that would be confusing as usernames
+var reservedUsernames = []string{"new", "quit", "admin", "all"}
+
+// ValidateUsername Check a name someone wants to register. Names are letters
+// and digits, starting with a letter, and mustn't be reserved.
+func ValidateUsername(username string) error {
+	if len(username) < minUsernameLength || len(username) > maxUsernameLength {
+		return fmt.Errorf("Names must be between %d and %d characters long", minUsernameLength, maxUsernameLength)
+	}
+	for i, r := range username {
+		isLetter := (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+		isDigit := r >= '0' && r <= '9'
+		if !isLetter && (i == 0 || !isDigit) {
+			return errors.New("Names must be letters and digits, starting with a letter")
+		}
+	}
+	for _, r := range reservedUsernames {
+		if strings.EqualFold(username, r) {
+			return errors.New("That name is reserved")
+		}
+	}
+	return nil
+}
+
+// ValidatePassword Check a password someone wants to use is long enough.
+func ValidatePassword(pwd string) error {
+	if len(pwd) < minPasswordLength {
+		return fmt.Errorf("Passwords must be at least %d characters long", minPasswordLength)
+	}
+	return nil
+}
 
+// LookupPlayer Check the player's password, returning the id of their actor. Accounts
+// which haven't made a character yet have no actor, so the id may be empty.
+// If the player is already logged in, the id comes back along with ErrAlreadyLoggedIn.
 func (pm DBPlayerMgr) LookupPlayer(username string, pwd string) (Id, error) {
-	rows, err := pm.db.Query(`
+	var (
+		storedPwd string
+		active    bool
+		actorId   sql.NullString
+	)
+	row := pm.db.QueryRow(`
 SELECT password, actor_id, active FROM player WHERE username = ?`, username)
+	err := row.Scan(&storedPwd, &actorId, &active)
+	if err == sql.ErrNoRows {
+		return "", ErrBadLogin
+	}
 	if err != nil {
 		return "", err
 	}
-	if rows.Next() {
-		var (
-			storedPwd string
-			active    bool
-			actorId   string
-		)
-		rows.Scan(&storedPwd, &actorId, &active)
-		// TODO: don't check passwords...we can't write them to DB yet!
-		if pwd != "" {
-			err = bcrypt.CompareHashAndPassword([]byte(storedPwd), []byte(pwd))
-			if err != nil {
-				return "", errors.New("Invalid username or password")
-			}
-		}
-		if active {
-			return "", errors.New("User is already logged in")
+	err = bcrypt.CompareHashAndPassword([]byte(storedPwd), []byte(pwd))
+	if err != nil {
+		return "", ErrBadLogin
+	}
+	if active {
+		// the credentials were good, so let the caller decide what to do about it
+		return Id(actorId.String), ErrAlreadyLoggedIn
+	}
+	return Id(actorId.String), nil
+}
+
+// PlayerExists Whether someone has registered username.
+func (pm DBPlayerMgr) PlayerExists(username string) (bool, error) {
+	var n int
+	err := pm.db.QueryRow(`SELECT count(*) FROM player WHERE username = ?`, username).Scan(&n)
+	return n > 0, err
+}
+
+// CreatePlayer Register a new account. It has no actor until the player makes a character.
+func (pm DBPlayerMgr) CreatePlayer(username string, pwd string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(pwd), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	res, err := pm.db.Exec(`INSERT OR IGNORE INTO player (username, password, active) VALUES (?, ?, false)`,
+		username, string(hash))
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrPlayerExists
+	}
+	return nil
+}
+
+// SetPassword Change the player's password.
+func (pm DBPlayerMgr) SetPassword(username string, pwd string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(pwd), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	_, err = pm.db.Exec(`UPDATE player SET password = ? WHERE username = ?`, string(hash), username)
+	return err
+}
+
+// SetActor Link the player to the actor they play.
+func (pm DBPlayerMgr) SetActor(username string, actorId Id) error {
+	_, err := pm.db.Exec(`UPDATE player SET actor_id = ? WHERE username = ?`, string(actorId), username)
+	return err
+}
+
+// LoadRole Get the player's role. Unknown roles in the DB are treated as plain players.
+func (pm DBPlayerMgr) LoadRole(username string) (Role, error) {
+	var name string
+	err := pm.db.QueryRow(`SELECT role FROM player WHERE username = ?`, username).Scan(&name)
+	if err != nil {
+		return RolePlayer, err
+	}
+	return ParseRole(name)
+}
+
+// SetRole Change the player's role.
+func (pm DBPlayerMgr) SetRole(username string, role Role) error {
+	res, err := pm.db.Exec(`UPDATE player SET role = ? WHERE username = ?`, role.String(), username)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("There's no player called '%s'", username)
+	}
+	return nil
+}
+
+// SetActive Record whether the player is logged in.
+func (pm DBPlayerMgr) SetActive(username string, active bool) error {
+	_, err := pm.db.Exec(`UPDATE player SET active = ? WHERE username = ?`, active, username)
+	return err
+}
+
+// ClearActive Mark everyone as logged out. Only call this when nobody can be connected.
+func (pm DBPlayerMgr) ClearActive() error {
+	_, err := pm.db.Exec(`UPDATE player SET active = false WHERE active`)
+	return err
+}
+
+// LoadPrefs Get the display settings the player has chosen.
+func (pm DBPlayerMgr) LoadPrefs(username string) (Prefs, error) {
+	prefs := DefaultPrefs()
+	row := pm.db.QueryRow(`SELECT color, width FROM player WHERE username = ?`, username)
+	err := row.Scan(&prefs.Color, &prefs.Width)
+	if err != nil {
+		return DefaultPrefs(), err
+	}
+	return prefs, nil
+}
+
+// SavePrefs Remember the player's display settings for next time.
+func (pm DBPlayerMgr) SavePrefs(username string, prefs Prefs) error {
+	_, err := pm.db.Exec(`UPDATE player SET color = ?, width = ? WHERE username = ?`,
+		prefs.Color, prefs.Width, username)
+	return err
+}
+
+// LookupPlayerKey Like LookupPlayer, but authenticating with a public key the player has
+// registered rather than a password. Keys are in authorized_keys format.
+func (pm DBPlayerMgr) LookupPlayerKey(username string, key string) (Id, error) {
+	var (
+		actorId sql.NullString
+		active  bool
+	)
+	row := pm.db.QueryRow(`
+SELECT p.actor_id, p.active FROM player p JOIN player_key k ON p.username = k.username
+WHERE p.username = ? AND k.key = ?`, username, strings.TrimSpace(key))
+	err := row.Scan(&actorId, &active)
+	if err == sql.ErrNoRows {
+		return "", ErrBadLogin
+	}
+	if err != nil {
+		return "", err
+	}
+	if active {
+		// the credentials were good, so let the caller decide what to do about it
+		return Id(actorId.String), ErrAlreadyLoggedIn
+	}
+	return Id(actorId.String), nil
+}
+
+// PlayerKeys The public keys the player has registered.
+func (pm DBPlayerMgr) PlayerKeys(username string) ([]string, error) {
+	rows, err := pm.db.Query(`SELECT key FROM player_key WHERE username = ? ORDER BY rowid`, username)
+	if err != nil {
+		return nil, err
+	}
+	defer func(rows *sql.Rows) {
+		_ = rows.Close()
+	}(rows)
+	keys := []string{}
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
 		}
-		return Id(actorId), nil
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// AddPlayerKey Register a public key the player can log in with.
+func (pm DBPlayerMgr) AddPlayerKey(username string, key string) error {
+	_, err := pm.db.Exec(`INSERT OR IGNORE INTO player_key (username, key) VALUES (?, ?)`,
+		username, strings.TrimSpace(key))
+	return err
+}
+
+// RemovePlayerKey Stop accepting a public key for the player.
+func (pm DBPlayerMgr) RemovePlayerKey(username string, key string) error {
+	_, err := pm.db.Exec(`DELETE FROM player_key WHERE username = ? AND key = ?`,
+		username, strings.TrimSpace(key))
+	return err
+}
+
+// LoginFailures Get the recent failures for subject. Subjects that have never
+// failed have none.
+func (pm DBPlayerMgr) LoginFailures(subject string) (LoginFailures, error) {
+	var count, last, lockedUntil int64
+	row := pm.db.QueryRow(`SELECT failures, last_failure, locked_until FROM login_failure WHERE subject = ?`, subject)
+	err := row.Scan(&count, &last, &lockedUntil)
+	if err == sql.ErrNoRows {
+		return LoginFailures{}, nil
 	}
-	return "", errors.New("Invalid username or password")
+	if err != nil {
+		return LoginFailures{}, err
+	}
+	return LoginFailures{
+		Count:       int(count),
+		Last:        time.Unix(last, 0),
+		LockedUntil: time.Unix(lockedUntil, 0),
+	}, nil
+}
+
+// SaveLoginFailures Record the failures for subject.
+func (pm DBPlayerMgr) SaveLoginFailures(subject string, f LoginFailures) error {
+	_, err := pm.db.Exec(`
+INSERT INTO login_failure (subject, failures, last_failure, locked_until) VALUES (?, ?, ?, ?)
+ON CONFLICT (subject) DO UPDATE SET failures = excluded.failures,
+	last_failure = excluded.last_failure, locked_until = excluded.locked_until`,
+		subject, f.Count, f.Last.Unix(), f.LockedUntil.Unix())
+	return err
+}
+
+// ClearLoginFailures Forget subject's failures, after they've logged in successfully.
+func (pm DBPlayerMgr) ClearLoginFailures(subject string) error {
+	_, err := pm.db.Exec(`DELETE FROM login_failure WHERE subject = ?`, subject)
+	return err
 }
@@ -0,0 +1,40 @@
+package entity
+
+import "testing"
+
+func TestValidateUsername(t *testing.T) {
+	for _, name := range []string{"bob", "Alice", "zed99"} {
+		if err := ValidateUsername(name); err != nil {
+			t.Errorf("Expected '%s' to be a valid name, got: %s", name, err)
+		}
+	}
+	for _, name := range []string{"", "al", "9lives", "bob smith", "x_y", "new", "NEW", "averyveryverylongname"} {
+		if err := ValidateUsername(name); err == nil {
+			t.Errorf("Expected '%s' to be rejected", name)
+		}
+	}
+}
+
+func TestValidatePassword(t *testing.T) {
+	if err := ValidatePassword("hunter"); err != nil {
+		t.Errorf("Expected a six character password to be allowed, got: %s", err)
+	}
+	if err := ValidatePassword("12345"); err == nil {
+		t.Error("Expected a five character password to be rejected")
+	}
+}
+
+func TestParseRole(t *testing.T) {
+	for _, role := range []Role{RolePlayer, RoleBuilder, RoleAdmin, RoleOwner} {
+		parsed, err := ParseRole(role.String())
+		if err != nil || parsed != role {
+			t.Errorf("Expected '%s' to parse back to itself, got %s (%v)", role, parsed, err)
+		}
+	}
+	if r, _ := ParseRole("ADMIN"); r != RoleAdmin {
+		t.Errorf("Expected role names to be case insensitive, got %s", r)
+	}
+	if _, err := ParseRole("god"); err == nil {
+		t.Error("Expected an unknown role to be rejected")
+	}
+}
@@ -78,12 +78,41 @@ func (r *Room) Find(word string) interface{} {
 	return bestMatch.matched
 }
 
+// FindAll Search the room for everyone and everything that matches the words as
+// well as anything does. Actors come before things.
+func (r *Room) FindAll(words []string) []interface{} {
+	actors, actorLevel := bestMatches(r.Actors, words)
+	things, thingLevel := bestMatches(r.Things, words)
+	found := []interface{}{}
+	if actorLevel >= thingLevel {
+		for _, actor := range actors {
+			found = append(found, actor)
+		}
+	}
+	if thingLevel >= actorLevel {
+		for _, thing := range things {
+			found = append(found, thing)
+		}
+	}
+	return found
+}
+
 // InsertActor Unconditionally add an actor to the room
 func (r *Room) InsertActor(actor *Actor) {
 	actor.SetRoom(r)
 	r.Actors = append(r.Actors, actor)
 }
 
+// HasActor Whether the actor is in the room.
+func (r *Room) HasActor(actor *Actor) bool {
+	for _, item := range r.Actors {
+		if item == actor {
+			return true
+		}
+	}
+	return false
+}
+
 // RemoveActor Unconditionally remove an actor from the room.
 func (r *Room) RemoveActor(actor *Actor) {
 	for i, item := range r.Actors {
@@ -96,6 +125,7 @@ func (r *Room) RemoveActor(actor *Actor) {
 // Insert Unconditionally add a thing to the room.
 func (r *Room) Insert(thing *Thing) {
 	thing.ParentId = r.Id
+	thing.dirty = true
 	r.Things = append(r.Things, thing)
 	r.dirty = true
 }
@@ -119,5 +149,11 @@ func (r *Room) Save(db *sql.DB) error {
 			return err
 		}
 	}
+	for _, thing := range r.Things {
+		err := thing.Save(db)
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
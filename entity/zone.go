@@ -8,6 +8,7 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 
 	_ "github.com/mattn/go-sqlite3"
@@ -26,6 +27,7 @@ type Zone struct {
 	Id     Id
 	Rooms  map[Id]*Room
 	Actors map[Id]*Actor
+	things map[Id]*Thing // every thing in the zone, wherever it is
 	db     *sql.DB
 }
 
@@ -99,24 +101,39 @@ func (z *Zone) loadZoneState(worldDir string) {
 	}
 	z.db = db
 	thingsById := LoadThings(z.db)
+	z.things = thingsById
 	// actors contain a thing reference for their physical form
 	actorsById := LoadActors(z.db, thingsById)
 	// add actors to rooms
 	z.Actors = make(map[Id]*Actor)
+	bodies := make(map[Id]bool)
 	for _, actor := range actorsById {
 		actor.Zone = z
 		z.Actors[actor.ID()] = actor
 		z.Rooms[actor.Body.ParentId].InsertActor(actor)
+		bodies[actor.Body.Id] = true
 	}
 	// add things to inventory, containers, or rooms
 	for _, thing := range thingsById {
+		if bodies[thing.Id] {
+			// already in the room as an actor
+			continue
+		}
 		switch IdTypeForId(thing.ParentId) {
 		case IdTypeRoom:
 			z.Rooms[thing.ParentId].Insert(thing)
 		case IdTypeInventory:
-			z.Actors[thing.ParentId].Insert(thing)
+			if actor := actorsById[thing.ParentId]; actor != nil {
+				actor.Insert(thing)
+				continue
+			}
+			log.Printf("Unable to find parent for %s with id %s", thing.Id, thing.ParentId)
 		case IdTypeContainer:
-			thingsById[thing.ParentId].Insert(thing)
+			if parent := thingsById[thing.ParentId]; parent != nil {
+				parent.Insert(thing)
+				continue
+			}
+			log.Printf("Unable to find parent for %s with id %s", thing.Id, thing.ParentId)
 		default:
 			log.Printf("Unable to find parent for %s with id %s", thing.Id, thing.ParentId)
 		}
@@ -134,6 +151,124 @@ func LoadZone(worldDir string, id Id) (*Zone, error) {
 	return zone, nil
 }
 
+// Physical attributes of a newly created actor's body. These match the sample man in zone 1.
+var (
+	newBodyWeight     = Attrib{100, 100}
+	newBodySize       = Attrib{10, 10}
+	newBodyDurability = Attrib{20, 20}
+)
+
+// createActor Make a new actor, and the body it inhabits, in room. Both are written
+// to the zone's DB straight away, so the actor exists even if the zone isn't saved.
+// The ids come from ZoneManager.CreateActor, which makes sure no other zone has them.
+func (z *Zone) createActor(actorId Id, thingId Id, title string, desc string, stats Stats, room *Room) (*Actor, error) {
+	tx, err := z.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func(tx *sql.Tx) {
+		// does nothing once committed
+		_ = tx.Rollback()
+	}(tx)
+	body := NewThing()
+	body.Id = thingId
+	body.Title = title
+	body.Desc = desc
+	body.ParentId = room.Id
+	body.Weight = newBodyWeight
+	body.Size = newBodySize
+	body.Durability = newBodyDurability
+	attribs := SerializeAttribList(body.Weight, body.Size, body.Durability)
+	_, err = tx.Exec(`INSERT INTO thing (id, attributes, title, description, location, flags) VALUES (?, ?, ?, ?, ?, ?)`,
+		body.Id, attribs, body.Title, body.Desc, body.ParentId, body.Flags.String())
+	if err != nil {
+		return nil, fmt.Errorf("unable to create body for %s: %w", title, err)
+	}
+	rawStats := SerializeAttribList(stats.Str, stats.Dex, stats.Int, stats.Will, stats.Health, stats.Mind)
+	_, err = tx.Exec(`INSERT INTO actor (id, thing_id, stats) VALUES (?, ?, ?)`, actorId, body.Id, rawStats)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create actor for %s: %w", title, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	actor := &Actor{
+		Id:    actorId,
+		Body:  body,
+		Stats: stats,
+		Zone:  z,
+	}
+	z.Actors[actor.ID()] = actor
+	z.things[body.Id] = body
+	room.InsertActor(actor)
+	log.Printf("INFO: created actor %s (%s) in %s", actor.Id, title, room.Id)
+	return actor, nil
+}
+
+// DeleteActor Remove an actor and its body from the world and the zone's DB,
+// say when its player couldn't be given it. Anything it was carrying goes too.
+func (z *Zone) DeleteActor(actor *Actor) error {
+	tx, err := z.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+	if _, err := tx.Exec(`DELETE FROM actor WHERE id = ?`, actor.Id); err != nil {
+		return err
+	}
+	// the body, and everything in it however deep
+	if _, err := tx.Exec(`
+WITH RECURSIVE inside(id) AS (
+	SELECT ?
+	UNION SELECT thing.id FROM thing JOIN inside ON thing.location = inside.id
+)
+DELETE FROM thing WHERE id IN inside`, actor.Body.Id); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	if room := actor.Room(); room != nil {
+		room.RemoveActor(actor)
+	}
+	z.forget(actor.Body)
+	delete(z.Actors, actor.ID())
+	log.Printf("INFO: deleted actor %s (%s)", actor.Id, actor.GetTitle())
+	return nil
+}
+
+// forget Drop a thing, and everything in it, from the zone's index.
+func (z *Zone) forget(thing *Thing) {
+	for _, child := range thing.Contents {
+		z.forget(child)
+	}
+	delete(z.things, thing.Id)
+}
+
+// highestId The highest number after prefix among the ids in table.
+func highestId(db *sql.DB, table string, prefix string) (int, error) {
+	rows, err := db.Query(fmt.Sprintf(`SELECT id FROM %s WHERE id LIKE ?`, table), prefix+"%")
+	if err != nil {
+		return 0, err
+	}
+	defer func(rows *sql.Rows) {
+		_ = rows.Close()
+	}(rows)
+	highest := 0
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return 0, err
+		}
+		if n, err := strconv.Atoi(strings.TrimPrefix(id, prefix)); err == nil && n > highest {
+			highest = n
+		}
+	}
+	return highest, rows.Err()
+}
+
 func (z *Zone) MoveActor(actor *Actor, room *Room) bool {
 	curRoom := actor.Room()
 	if curRoom != nil {
@@ -145,23 +280,70 @@ func (z *Zone) MoveActor(actor *Actor, room *Room) bool {
 	return true
 }
 
+// Withdraw Take an actor out of the world, say when its player has logged off.
+// It keeps its place, so that Restore can put it back.
+func (z *Zone) Withdraw(actor *Actor) {
+	room := actor.Room()
+	if room == nil {
+		return
+	}
+	room.RemoveActor(actor)
+}
+
+// Restore Put a withdrawn actor back in the room it left. Does nothing if it's still there.
+func (z *Zone) Restore(actor *Actor) {
+	room := actor.Room()
+	if room == nil || room.HasActor(actor) {
+		return
+	}
+	room.InsertActor(actor)
+}
+
+// FindThing Look up any thing in the zone by its id, wherever it is.
+func (z *Zone) FindThing(id Id) *Thing {
+	return z.things[id]
+}
+
+// detach Take a thing out of whatever is holding it.
+func (z *Zone) detach(thing *Thing) {
+	switch IdTypeForId(thing.ParentId) {
+	case IdTypeRoom:
+		if room := z.Rooms[thing.ParentId]; room != nil {
+			room.Remove(thing)
+		}
+	case IdTypeContainer:
+		if parent := z.things[thing.ParentId]; parent != nil {
+			parent.Remove(thing)
+		}
+	case IdTypeInventory:
+		for _, actor := range z.Actors {
+			if actor.Id == thing.ParentId {
+				actor.Remove(thing)
+			}
+		}
+	}
+}
+
+// TakeThing Move a thing into an actor's inventory, if it can carry it.
 func (z *Zone) TakeThing(thing *Thing, actor *Actor) bool {
-	idType := IdTypeForId(thing.ParentId)
-	if idType == IdTypeRoom {
-		room := z.Rooms[thing.ParentId]
-		room.Remove(thing)
-	} else if idType == IdTypeContainer {
-		// oh shit, I don't know how to find the container!
-	} else if idType == IdTypeInventory {
-		actor := z.Actors[thing.ParentId]
-		actor.Remove(thing)
-	}
-	thing.ParentId = actor.ID()
+	if !actor.Accept(thing) {
+		return false
+	}
+	z.detach(thing)
 	actor.Insert(thing)
-	// TODO: we'll eventually check various things, like capacity, etc.
 	return true
 }
 
+// PutThing Move a thing into a container, if it fits.
+func (z *Zone) PutThing(thing *Thing, container *Thing) error {
+	if err := container.CanHold(thing); err != nil {
+		return err
+	}
+	z.detach(thing)
+	container.Insert(thing)
+	return nil
+}
+
 func (z *Zone) Save() {
 	trans, err := z.db.Begin()
 	if err != nil {
@@ -185,8 +367,18 @@ type ZoneManager struct {
 	zones map[Id]*Zone
 }
 
+// GetZoneMgr Load every zone in the world directory, which is $TEXTCRAWL_WORLD or ./world.
 func GetZoneMgr() (ZoneManager, error) {
-	zones, err := loadZones()
+	worldDir, ok := os.LookupEnv("TEXTCRAWL_WORLD")
+	if !ok {
+		worldDir = "./world"
+	}
+	return LoadZoneMgr(worldDir)
+}
+
+// LoadZoneMgr Load every zone in worldDir.
+func LoadZoneMgr(worldDir string) (ZoneManager, error) {
+	zones, err := loadZones(worldDir)
 	if err != nil {
 		return ZoneManager{
 			zones: map[Id]*Zone{},
@@ -205,12 +397,8 @@ func (zm *ZoneManager) GetZone(id Id) (*Zone, error) {
 	return z, nil
 }
 
-func loadZones() (map[Id]*Zone, error) {
+func loadZones(worldDir string) (map[Id]*Zone, error) {
 	zones := make(map[Id]*Zone, 0)
-	worldDir, ok := os.LookupEnv("TEXTCRAWL_WORLD")
-	if !ok {
-		worldDir = "./world"
-	}
 	entries, err := os.ReadDir(worldDir)
 	if err != nil {
 		return nil, fmt.Errorf("Could not access world directory: %s", err)
@@ -243,3 +431,32 @@ func (zm *ZoneManager) FindActor(actorId Id) (*Actor, error) {
 	}
 	return nil, fmt.Errorf("Actor '%s' cannot be found!", actorId)
 }
+
+// CreateActor Make a new actor in a room of zone z. Ids are meant to be unique
+// across zones, so they're one past the highest in any zone.
+func (zm *ZoneManager) CreateActor(z *Zone, title string, desc string, stats Stats, room *Room) (*Actor, error) {
+	thingId, err := zm.nextId("thing", "T")
+	if err != nil {
+		return nil, err
+	}
+	actorId, err := zm.nextId("actor", "A")
+	if err != nil {
+		return nil, err
+	}
+	return z.createActor(actorId, thingId, title, desc, stats, room)
+}
+
+// nextId An id that no zone uses in table: one past the highest numbered id with the prefix.
+func (zm *ZoneManager) nextId(table string, prefix string) (Id, error) {
+	highest := 0
+	for _, z := range zm.zones {
+		n, err := highestId(z.db, table, prefix)
+		if err != nil {
+			return "", err
+		}
+		if n > highest {
+			highest = n
+		}
+	}
+	return Id(fmt.Sprintf("%s%d", prefix, highest+1)), nil
+}
@@ -1,6 +1,9 @@
 package entity
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -26,3 +29,190 @@ func TestGetZone(t *testing.T) {
 	// 	t.Errorf("Expected object in room 1 to be 'tin knife', but got '%s'", child.Object.GetTitle())
 	// }
 }
+
+// tempZoneMgr Load the zones from a copy of the world, so tests can change them freely.
+func tempZoneMgr(t *testing.T) ZoneManager {
+	t.Helper()
+	worldDir, ok := os.LookupEnv("TEXTCRAWL_WORLD")
+	if !ok {
+		worldDir = "./world"
+	}
+	dir := t.TempDir()
+	for _, pattern := range []string{"*.yaml", "*.dat"} {
+		files, _ := filepath.Glob(filepath.Join(worldDir, pattern))
+		for _, f := range files {
+			data, err := os.ReadFile(f)
+			if err != nil {
+				t.Fatalf("Unable to read %s: %s", f, err)
+			}
+			if err := os.WriteFile(filepath.Join(dir, filepath.Base(f)), data, 0o644); err != nil {
+				t.Fatalf("Unable to copy %s: %s", f, err)
+			}
+		}
+	}
+	zm, err := LoadZoneMgr(dir)
+	if err != nil {
+		t.Fatalf("LoadZoneMgr returned an error: %s", err)
+	}
+	return zm
+}
+
+func TestCreateActor(t *testing.T) {
+	zm := tempZoneMgr(t)
+	z, _ := zm.GetZone(Id("1"))
+	room := z.GetRoom(Id("R1"))
+	stats := Stats{Str: Attrib{12, 12}}
+	actor, err := zm.CreateActor(z, "Tester", "someone testing things", stats, room)
+	if err != nil {
+		t.Fatalf("CreateActor returned an error: %s", err)
+	}
+	if actor.Id == "A1" || actor.Body.Id == "T2" {
+		t.Errorf("Expected new ids, got actor %s with body %s", actor.Id, actor.Body.Id)
+	}
+	if actor.Room() != room {
+		t.Errorf("Expected the actor to be in %s", room.Id)
+	}
+	if found, err := zm.FindActor(actor.Id); err != nil || found != actor {
+		t.Errorf("Expected to be able to find the new actor: %v", err)
+	}
+	// and it should be there when the zone is next loaded
+	things := LoadThings(z.db)
+	actors := LoadActors(z.db, things)
+	loaded := actors[actor.Id]
+	if loaded == nil {
+		t.Fatalf("Actor %s wasn't saved", actor.Id)
+	}
+	if loaded.Body.Title != "Tester" || loaded.Stats.Str.Real != 12 {
+		t.Errorf("Actor was saved as %s with %+v", loaded.Body.Title, loaded.Stats)
+	}
+}
+
+func TestCreateActorIdsAcrossZones(t *testing.T) {
+	zm := tempZoneMgr(t)
+	z0, err := zm.GetZone(Id("0"))
+	if err != nil {
+		t.Fatalf("GetZone returned an error: %s", err)
+	}
+	z1, _ := zm.GetZone(Id("1"))
+	// zone 0 has used ids past any in zone 1
+	highest, err := highestId(z1.db, "thing", "T")
+	if err != nil {
+		t.Fatalf("highestId returned an error: %s", err)
+	}
+	used := highest + 10
+	if _, err := z0.db.Exec(`INSERT INTO thing (id, attributes, title, description, location, flags) VALUES (?, '{}', 'elsewhere', '', '', '')`,
+		fmt.Sprintf("T%d", used)); err != nil {
+		t.Fatalf("Unable to add a thing to zone 0: %s", err)
+	}
+	if _, err := z0.db.Exec(`INSERT INTO actor (id, thing_id, stats) VALUES (?, ?, '{}')`,
+		fmt.Sprintf("A%d", used), fmt.Sprintf("T%d", used)); err != nil {
+		t.Fatalf("Unable to add an actor to zone 0: %s", err)
+	}
+	actor, err := zm.CreateActor(z1, "Tester", "", Stats{}, z1.GetRoom(Id("R1")))
+	if err != nil {
+		t.Fatalf("CreateActor returned an error: %s", err)
+	}
+	if actor.Id != Id(fmt.Sprintf("A%d", used+1)) || actor.Body.Id != Id(fmt.Sprintf("T%d", used+1)) {
+		t.Errorf("Expected ids past zone 0's, got actor %s with body %s", actor.Id, actor.Body.Id)
+	}
+}
+
+func TestDeleteActor(t *testing.T) {
+	zm := tempZoneMgr(t)
+	z, _ := zm.GetZone(Id("1"))
+	room := z.GetRoom(Id("R1"))
+	actor, err := zm.CreateActor(z, "Tester", "", Stats{}, room)
+	if err != nil {
+		t.Fatalf("CreateActor returned an error: %s", err)
+	}
+	// carrying a bag with a gem in it
+	bag := &Thing{Id: "T91", Title: "bag", Flags: FlagContainer}
+	gem := &Thing{Id: "T92", Title: "gem"}
+	for _, thing := range []*Thing{bag, gem} {
+		z.things[thing.Id] = thing
+	}
+	actor.Body.Insert(bag)
+	bag.Insert(gem)
+	for _, row := range [][]string{{"T91", string(actor.Body.Id)}, {"T92", "T91"}} {
+		if _, err := z.db.Exec(`INSERT INTO thing (id, attributes, title, description, location, flags) VALUES (?, '1:1,1:1,1:1', '', '', ?, '')`, row[0], row[1]); err != nil {
+			t.Fatalf("Unable to add %s: %s", row[0], err)
+		}
+	}
+	if err := z.DeleteActor(actor); err != nil {
+		t.Fatalf("DeleteActor returned an error: %s", err)
+	}
+	if _, err := zm.FindActor(actor.Id); err == nil {
+		t.Errorf("Expected %s to be gone", actor.Id)
+	}
+	for _, a := range room.Actors {
+		if a == actor {
+			t.Errorf("Expected %s to have left %s", actor.Id, room.Id)
+		}
+	}
+	things := LoadThings(z.db)
+	if things[actor.Body.Id] != nil || LoadActors(z.db, things)[actor.Id] != nil {
+		t.Errorf("Expected %s to be deleted from the DB", actor.Id)
+	}
+	if things["T91"] != nil || things["T92"] != nil || z.things["T92"] != nil {
+		t.Error("Expected everything the actor carried, however deep, to be deleted too")
+	}
+	// and its ids aren't in use any more, so they can be handed out again
+	again, err := zm.CreateActor(z, "Again", "", Stats{}, room)
+	if err != nil {
+		t.Fatalf("CreateActor returned an error: %s", err)
+	}
+	if again.Id != actor.Id {
+		t.Errorf("Expected %s to be reused, got %s", actor.Id, again.Id)
+	}
+}
+
+func TestBodiesAreNotThings(t *testing.T) {
+	zm, err := GetZoneMgr()
+	if err != nil {
+		t.Fatalf("GetZoneMgr returned an error: %s", err)
+	}
+	z, _ := zm.GetZone(Id("1"))
+	room := z.GetRoom(Id("R1"))
+	for _, thing := range room.Things {
+		if thing.Id == "T2" {
+			t.Error("Expected A1's body to be in the room as an actor, not a thing")
+		}
+	}
+	found := false
+	for _, actor := range room.Actors {
+		found = found || actor.Body.Id == "T2"
+	}
+	if !found {
+		t.Errorf("Expected A1 to be in the room")
+	}
+}
+
+func TestPutThing(t *testing.T) {
+	zm, err := GetZoneMgr()
+	if err != nil {
+		t.Fatalf("GetZoneMgr returned an error: %s", err)
+	}
+	z, _ := zm.GetZone(Id("1"))
+	room := z.GetRoom(Id("R1"))
+	knife, bucket := z.FindThing("T1"), z.FindThing("T3")
+	if knife == nil || bucket == nil || z.FindThing("T2") == nil {
+		t.Fatal("Expected to find the knife, the bucket and A1's body")
+	}
+	if err := z.PutThing(knife, bucket); err != nil {
+		t.Fatalf("Expected the knife to go in the bucket, got %s", err)
+	}
+	if knife.ParentId != "T3" || len(bucket.Contents) != 1 {
+		t.Errorf("Expected the knife to be in the bucket, it's in %s", knife.ParentId)
+	}
+	for _, thing := range room.Things {
+		if thing == knife {
+			t.Error("Expected the knife to have left the room")
+		}
+	}
+
+	actor := z.Actors["T2"]
+	z.TakeThing(knife, actor)
+	if len(bucket.Contents) != 0 || knife.ParentId != actor.Body.Id || actor.Body.Contents[0] != knife {
+		t.Errorf("Expected the knife to be taken out of the bucket, it's in %s", knife.ParentId)
+	}
+}
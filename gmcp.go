@@ -0,0 +1,85 @@
+package main
+
+import (
+	"io"
+
+	cmd "rob.co/textcrawl/command"
+	entity "rob.co/textcrawl/entity"
+	"rob.co/textcrawl/markup"
+)
+
+// GMCP payloads the engine sends on its own account.
+// Scripts can send anything else through req:SendGMCP.
+
+type gmcpVitals struct {
+	Health    int `json:"health"`
+	MaxHealth int `json:"maxhealth"`
+	Mind      int `json:"mind"`
+	MaxMind   int `json:"maxmind"`
+}
+
+type gmcpRoomInfo struct {
+	Num   entity.Id            `json:"num"`
+	Name  string               `json:"name"`
+	Zone  entity.Id            `json:"zone"`
+	Exits map[string]entity.Id `json:"exits"`
+}
+
+type gmcpItem struct {
+	Id   entity.Id `json:"id"`
+	Name string    `json:"name"`
+}
+
+type gmcpItems struct {
+	Location string     `json:"location"`
+	Items    []gmcpItem `json:"items"`
+}
+
+// sendVitals Char.Vitals: the actor's health and mind.
+func sendVitals(w io.Writer, a *entity.Actor) {
+	cmd.SendGMCP(w, "Char.Vitals", gmcpVitals{
+		Health:    a.Stats.Health.Cur,
+		MaxHealth: a.Stats.Health.Real,
+		Mind:      a.Stats.Mind.Cur,
+		MaxMind:   a.Stats.Mind.Real,
+	})
+}
+
+// sendRoomInfo Room.Info: where the actor is, for mappers.
+func sendRoomInfo(w io.Writer, a *entity.Actor) {
+	room := a.Room()
+	if room == nil {
+		return
+	}
+	exits := make(map[string]entity.Id)
+	for _, exit := range room.Exits {
+		exits[string(exit.Direction)] = exit.Destination
+	}
+	cmd.SendGMCP(w, "Room.Info", gmcpRoomInfo{
+		Num:   room.Id,
+		Name:  markup.Strip(room.Title),
+		Zone:  a.Zone.Id,
+		Exits: exits,
+	})
+}
+
+// sendItems Char.Items.List: what the actor is carrying.
+func sendItems(w io.Writer, a *entity.Actor) {
+	items := make([]gmcpItem, 0, len(a.Body.Contents))
+	for _, t := range a.Body.Contents {
+		items = append(items, gmcpItem{Id: t.Id, Name: markup.Strip(t.Title)})
+	}
+	cmd.SendGMCP(w, "Char.Items.List", gmcpItems{
+		Location: "inv",
+		Items:    items,
+	})
+}
+
+// sendStatus Bring the client's UI up to date after a command.
+func sendStatus(w io.Writer, a *entity.Actor, moved bool) {
+	sendVitals(w, a)
+	sendItems(w, a)
+	if moved {
+		sendRoomInfo(w, a)
+	}
+}
@@ -6,6 +6,9 @@ require (
 	github.com/mattn/go-sqlite3 v1.14.16
 	github.com/yuin/gopher-lua v1.1.0
 	golang.org/x/crypto v0.8.0
+	golang.org/x/net v0.9.0
 	gopkg.in/yaml.v3 v3.0.1
 	layeh.com/gopher-luar v1.0.10
 )
+
+require golang.org/x/sys v0.7.0 // indirect
@@ -1,17 +1,76 @@
 
+-- how a thing appears in a list of what's about
+local function seen(thing)
+   if thing:HasFlag("light") then
+	  return thing.Title .. " (glowing)"
+   end
+   return thing.Title
+end
+
+-- "look in <container>"
+local function lookIn(req)
+   if #req.Cmd.IndirectObjs == 0 then
+	  req:Write("Look in what?\n")
+	  return
+   end
+   local obj = req.Cmd.IndirectObjs[1]
+   local container = obj:Thing()
+   if obj.Ref and not container then
+	  req:Write("You can't look inside " .. obj.Ref:GetTitle() .. "\n")
+   elseif not container then
+	  req:Write("I don't see a " .. obj.Text .. " here\n")
+   elseif not container:IsContainer() then
+	  req:Write("You can't look inside the " .. container.Title .. "\n")
+   elseif container:IsClosed() then
+	  req:Write("The " .. container.Title .. " is closed\n")
+   else
+	  local found = false
+	  for i = 1, #container.Contents do
+		 local thing = container.Contents[i]
+		 if thing:Visible() then
+			if not found then
+			   req:Write("The " .. container.Title .. " has in it:\n")
+			   found = true
+			end
+			req:Write("  " .. seen(thing) .. "\n")
+		 end
+	  end
+	  if not found then
+		 req:Write("The " .. container.Title .. " is empty\n")
+	  end
+   end
+end
+
 function look(req)
+   local prep = req.Cmd.Preposition
+   if prep == "in" or prep == "inside" or prep == "into" then
+	  lookIn(req)
+	  return
+   end
    room = req.Actor:Room()
+   req:Write("{W}" .. room.Title .. "{x}\n")
    req:Write(room.Desc .. "\n")
-   if room.Things and #room.Things > 0 then
+   local things = {}
+   for i = 1, #room.Things do
+	  if room.Things[i]:Visible() then
+		 table.insert(things, room.Things[i])
+	  end
+   end
+   if #things > 0 then
 	  req:Write("You see here:\n")
-	  for i = 1, #room.Things do
-		 req:Write("  " .. room.Things[i].Title .. "\n")
+	  for i = 1, #things do
+		 req:Write("  " .. seen(things[i]) .. "\n")
 	  end
    end
    if room.Actors and #room.Actors > 0 then
 	  req:Write("There are in this room:\n")
 	  for i = 1, #room.Actors do
-		 req:Write("  " .. room.Actors[i].Body.Title .. "\n")
+		 local actor = room.Actors[i]
+		 if actor.LinkDead then
+			req:Write("  " .. actor.Body.Title .. " (link-dead)\n")
+		 else
+			req:Write("  " .. actor.Body.Title .. "\n")
+		 end
 	  end
    end
 
@@ -28,7 +87,12 @@ function goDirection(req, dir)
    if exit then
 	  newRoom = req.Actor.Zone:GetRoom(exit.Destination)
 	  
-	  if req.Actor.Zone:MoveActor(req.Actor, newRoom) then
+	  local ticks = req.Actor:MoveTicks()
+	  if ticks > 1 then
+		 -- a heavy load slows the walk itself; the engine moves us once the ticks pass
+		 req:Write("You set off " .. dir .. ", trudging under the weight of everything you're carrying\n")
+		 req.Actor:Travel(newRoom, ticks)
+	  elseif req.Actor.Zone:MoveActor(req.Actor, newRoom) then
 		 req:Write("You go " .. dir .. "\n")
 		 look(req)
 	  else
@@ -39,18 +103,51 @@ function goDirection(req, dir)
    end
 end
 
+command{
+   name = "take",
+   aliases = {"get"},
+   priority = 5,
+   syntax = "take <thing> [from <container>] | take all | take all.<thing> | take <number> <things>",
+   help = "Pick something up from the room you're in, or take it out of a container.",
+   resting = true,
+   scope = "room",
+}
 function take(req)
+	local from = nil
+	if req.Cmd.Preposition == "from" then
+		from = #req.Cmd.IndirectObjs > 0 and req.Cmd.IndirectObjs[1]:Thing()
+		if not from then
+			req:Write("Take it from what?\n")
+			return
+		end
+		if from:IsClosed() then
+			req:Write("The " .. from.Title .. " is closed\n")
+			return
+		end
+	end
 	if #req.Cmd.DirectObjs == 0 then
 		req:Write("Take what?")
 	else
 		for i = 1, #req.Cmd.DirectObjs do
 			obj = req.Cmd.DirectObjs[i]
-			if obj.Ref then
-				if req.Actor:Take(obj.Ref) then
-					req:Write("You get the " .. obj.Ref.Title .. "\n")
+			thing = obj:Thing()
+			if thing then
+				local err = req.Actor:CanCarry(thing)
+				if err then
+					req:Write("You can't take the " .. thing.Title .. ": " .. err:Error() .. "\n")
+				elseif req.Actor:Take(thing) then
+					req:Write("You get the " .. thing.Title .. "\n")
 				else
-					req:Write("You failed to take " .. obj.Ref.Title .. "\n")
+					req:Write("You failed to take " .. thing.Title .. "\n")
 				end
+			elseif obj.Ref then
+				req:Write("You can't take " .. obj.Ref:GetTitle() .. "\n")
+			elseif from and obj.Several then
+				req:Write("There's nothing like that in the " .. from.Title .. "\n")
+			elseif from then
+				req:Write("There's no " .. obj.Text .. " in the " .. from.Title .. "\n")
+			elseif obj.Several then
+				req:Write("There's nothing like that here\n")
 			else
 				req:Write("I don't see a " .. obj.Text .. " here\n")
 			end
@@ -58,18 +155,30 @@ function take(req)
 	end
 end
 
+command{
+   name = "drop",
+   syntax = "drop <thing> | drop all | drop all.<thing> | drop <number> <things>",
+   help = "Put down something you're carrying.",
+   resting = true,
+   scope = "inventory",
+}
 function drop( req )
 	if #req.Cmd.DirectObjs == 0 then
 		req:Write("Drop what?")
 	else
 		for i = 1, #req.Cmd.DirectObjs do
 			obj = req.Cmd.DirectObjs[i]
-			if obj.Ref then
-				if req.Actor:Drop(obj.Ref) then
-				req:Write("You dropped the " .. obj.Ref.Title .. "\n")
+			thing = obj:Thing()
+			if thing and thing:HasFlag("nodrop") then
+				req:Write("You can't let go of the " .. thing.Title .. "\n")
+			elseif thing then
+				if req.Actor:Drop(thing) then
+				req:Write("You dropped the " .. thing.Title .. "\n")
 				else
-				req:Write("You failed to drop the " .. obj.Ref.Title .. "\n")
+				req:Write("You failed to drop the " .. thing.Title .. "\n")
 				end
+			elseif obj.Several then
+				req:Write("You aren't carrying anything like that\n")
 			else
 				req:Write("You don't have a " .. obj.Text .. "\n")
 	  		end
@@ -77,15 +186,126 @@ function drop( req )
 	end
 end
 
+command{
+   name = "put",
+   syntax = "put <thing> in <container>",
+   help = "Put something you're carrying into a container.",
+   resting = true,
+   scope = "inventory",
+}
+function put(req)
+	local cmd = req.Cmd
+	if #cmd.DirectObjs == 0 then
+		req:Write("Put what?\n")
+		return
+	end
+	if cmd.Preposition ~= "in" and cmd.Preposition ~= "into" and cmd.Preposition ~= "inside" then
+		req:Write("Put it in what?\n")
+		return
+	end
+	local container = #cmd.IndirectObjs > 0 and cmd.IndirectObjs[1]:Thing()
+	if not container then
+		if #cmd.IndirectObjs > 0 and cmd.IndirectObjs[1].Ref then
+			req:Write("You can't put things in " .. cmd.IndirectObjs[1].Ref:GetTitle() .. "\n")
+		else
+			req:Write("I don't see that here\n")
+		end
+		return
+	end
+	for i = 1, #cmd.DirectObjs do
+		local obj = cmd.DirectObjs[i]
+		local thing = obj:Thing()
+		if thing then
+			local err = req.Actor:Put(thing, container)
+			if err then
+				req:Write("You can't put the " .. thing.Title .. " in the " .. container.Title .. ": " .. err:Error() .. "\n")
+			else
+				req:Write("You put the " .. thing.Title .. " in the " .. container.Title .. "\n")
+			end
+		elseif obj.Several then
+			req:Write("You aren't carrying anything like that\n")
+		else
+			req:Write("You don't have a " .. obj.Text .. "\n")
+		end
+	end
+end
+
+-- wear, wield and remove all work the same way, on each thing they're given
+local function equip(req, verb, using)
+	if #req.Cmd.DirectObjs == 0 then
+		req:Write(verb .. " what?\n")
+		return
+	end
+	for i = 1, #req.Cmd.DirectObjs do
+		local obj = req.Cmd.DirectObjs[i]
+		local thing = obj:Thing()
+		if thing then
+			local err = using(thing)
+			if err then
+				req:Write("You can't " .. verb:lower() .. " the " .. thing.Title .. ": " .. err:Error() .. "\n")
+			else
+				req:Write("You " .. verb:lower() .. " the " .. thing.Title .. "\n")
+			end
+		elseif obj.Several then
+			req:Write("You don't have anything like that\n")
+		else
+			req:Write("You don't have a " .. obj.Text .. "\n")
+		end
+	end
+end
+
+command{
+   name = "wear",
+   syntax = "wear <thing> | wear all",
+   help = "Put on something you're carrying.",
+   resting = true,
+   scope = "inventory",
+}
+function wear(req)
+	equip(req, "Wear", function(thing) return req.Actor:Wear(thing) end)
+end
+
+command{
+   name = "wield",
+   syntax = "wield <thing>",
+   help = "Take something you're carrying in hand, ready to use. A second thing goes in your off hand.",
+   resting = true,
+   fighting = true,
+   scope = "inventory",
+}
+function wield(req)
+	equip(req, "Wield", function(thing) return req.Actor:Wield(thing) end)
+end
+
+command{
+   name = "remove",
+   syntax = "remove <thing> | remove all",
+   help = "Stop wearing or wielding something. You keep hold of it.",
+   resting = true,
+   scope = "equipment",
+}
+function remove(req)
+	equip(req, "Remove", function(thing) return req.Actor:Unequip(thing) end)
+end
+
 function inventory(req)
+   local things = req.Actor:Carrying()
    req:Write("You have:\n")
-   for i = 1, #req.Actor.Body.Contents do
-	  req:Write("* " .. req.Actor.Body.Contents[i].Title .. "\n")
+   for i = 1, #things do
+	  req:Write("* " .. things[i].Title .. "\n")
    end
+   req:Write("You're carrying " .. req.Actor:Carried() .. " of the " .. req.Actor:Capacity() .. " you can manage\n")
 end
 
 
+command{
+   name = "quit",
+   prefix = 4,
+   syntax = "quit",
+   help = "Leave the game.",
+   resting = true,
+}
 function quit(req)
    req:Write("Goodbye...\n")
-   req.Writer:Close()
+   req:Quit()
 end
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// The longest we'll make someone wait after a failed login
+const maxLoginDelay = 30 * time.Second
+
+// Failed logins are counted against both the username tried and the address they
+// came from, so that neither guessing one password from many places nor many
+// usernames from one place gets far. Every decision is logged with a "LOGIN"
+// prefix, so `grep LOGIN` shows the whole story.
+
+func userSubject(username string) string {
+	return "user:" + username
+}
+
+func ipSubject(ip string) string {
+	return "ip:" + ip
+}
+
+// remoteIP The address a connection comes from, without the port.
+func remoteIP(conn net.Conn) string {
+	addr := conn.RemoteAddr().String()
+	if ws, ok := conn.(*websocket.Conn); ok {
+		// a WebSocket's RemoteAddr is the page's origin; the peer is on the request
+		addr = ws.Request().RemoteAddr
+	}
+	return hostOf(addr)
+}
+
+// hostOf Drop the port from a "host:port" address.
+func hostOf(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
+
+// lockedOut How long until subject may try to log in again. Zero if it isn't locked out.
+func (s *Server) lockedOut(subject string) time.Duration {
+	f, err := s.playerMgr.LoginFailures(subject)
+	if err != nil {
+		log.Printf("WARN: unable to check login failures for %s: %s", subject, err)
+		return 0
+	}
+	wait := time.Until(f.LockedUntil)
+	if wait < 0 {
+		return 0
+	}
+	return wait
+}
+
+// loginFailed Note a failed login for username from ip, locking either of them
+// out if they've failed too often. Returns how long to make them wait before
+// they can try again, which doubles with each failure.
+func (s *Server) loginFailed(ip string, username string) time.Duration {
+	now := time.Now()
+	worst := 0
+	for _, subject := range []string{ipSubject(ip), userSubject(username)} {
+		f, err := s.playerMgr.LoginFailures(subject)
+		if err != nil {
+			log.Printf("WARN: unable to check login failures for %s: %s", subject, err)
+			continue
+		}
+		if now.Sub(f.Last) > s.config.LockoutDuration {
+			// the old ones have expired
+			f.Count = 0
+		}
+		f.Count++
+		f.Last = now
+		if s.config.LockoutFailures > 0 && f.Count >= s.config.LockoutFailures {
+			f.LockedUntil = now.Add(s.config.LockoutDuration)
+			log.Printf("LOGIN LOCKOUT %s after %d failures, until %s", subject, f.Count, f.LockedUntil.Format(time.RFC3339))
+		}
+		if err := s.playerMgr.SaveLoginFailures(subject, f); err != nil {
+			log.Printf("WARN: unable to record login failure for %s: %s", subject, err)
+		}
+		if f.Count > worst {
+			worst = f.Count
+		}
+	}
+	log.Printf("LOGIN FAIL user=%q ip=%s failures=%d", username, ip, worst)
+	return loginDelay(s.config.LoginDelay, worst)
+}
+
+// loginDelay How long to wait after the nth failure in a row.
+func loginDelay(base time.Duration, n int) time.Duration {
+	delay := base
+	for i := 1; i < n && delay < maxLoginDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxLoginDelay {
+		return maxLoginDelay
+	}
+	return delay
+}
+
+// loginSucceeded Forget the failures for username now they've got it right. The
+// address's failures stand, or logging in to an account of your own between
+// guesses at someone else's would reset them.
+func (s *Server) loginSucceeded(ip string, username string) {
+	log.Printf("LOGIN OK user=%q ip=%s", username, ip)
+	subject := userSubject(username)
+	if err := s.playerMgr.ClearLoginFailures(subject); err != nil {
+		log.Printf("WARN: unable to clear login failures for %s: %s", subject, err)
+	}
+}
+
+// formatWait Describe a lockout's remaining time to the player.
+func formatWait(d time.Duration) string {
+	minutes := int((d + time.Minute - 1) / time.Minute)
+	if minutes <= 1 {
+		return "a minute"
+	}
+	return fmt.Sprintf("%d minutes", minutes)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	entity "rob.co/textcrawl/entity"
+)
+
+// failingPlayerMgr Rejects every password and remembers login failures.
+type failingPlayerMgr struct {
+	DummyPlayerMgr
+	failures map[string]entity.LoginFailures
+}
+
+func (pm failingPlayerMgr) LookupPlayer(username string, pwd string) (entity.Id, error) {
+	return "", entity.ErrBadLogin
+}
+
+func (pm failingPlayerMgr) LoginFailures(subject string) (entity.LoginFailures, error) {
+	return pm.failures[subject], nil
+}
+
+func (pm failingPlayerMgr) SaveLoginFailures(subject string, f entity.LoginFailures) error {
+	pm.failures[subject] = f
+	return nil
+}
+
+func (pm failingPlayerMgr) ClearLoginFailures(subject string) error {
+	delete(pm.failures, subject)
+	return nil
+}
+
+func TestLoginDelay(t *testing.T) {
+	if d := loginDelay(time.Second, 1); d != time.Second {
+		t.Errorf("Expected the first failure to wait a second, got %s", d)
+	}
+	if d := loginDelay(time.Second, 3); d != 4*time.Second {
+		t.Errorf("Expected the third failure to wait four seconds, got %s", d)
+	}
+	if d := loginDelay(time.Second, 100); d != maxLoginDelay {
+		t.Errorf("Expected the delay to be capped at %s, got %s", maxLoginDelay, d)
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	pm := failingPlayerMgr{failures: map[string]entity.LoginFailures{}}
+	s := NewServer(Config{MaxLoginFailures: 2, LockoutFailures: 3, LockoutDuration: time.Minute}, nil, nil, pm)
+
+	sess := newLoginSession(t)
+	loginSteps(s, sess, "", "foo", "wrong")
+	if sess.player.LoginState != entity.LoginStateFailed {
+		t.Fatalf("Expected a wrong password to start over, but state is %s", sess.player.LoginState)
+	}
+	loginSteps(s, sess, "foo", "wrong")
+	if sess.player.LoginState != entity.LoginStateMaxFailed {
+		t.Fatalf("Expected to be cut off after two failures, but state is %s", sess.player.LoginState)
+	}
+	if s.lockedOut(userSubject("foo")) != 0 {
+		t.Error("Expected foo not to be locked out yet")
+	}
+
+	// a third failure, from a fresh connection, locks out both the user and the address
+	sess = newLoginSession(t)
+	loginSteps(s, sess, "", "foo", "wrong")
+	if s.lockedOut(userSubject("foo")) == 0 || s.lockedOut(ipSubject(sess.ip)) == 0 {
+		t.Fatalf("Expected foo and %s to be locked out, failures are %v", sess.ip, pm.failures)
+	}
+	sess = newLoginSession(t)
+	loginSteps(s, sess, "")
+	if sess.player.LoginState != entity.LoginStateStart {
+		t.Errorf("Expected a locked out address not to be asked for a username, but state is %s", sess.player.LoginState)
+	}
+
+	s.loginSucceeded(sess.ip, "foo")
+	if s.lockedOut(userSubject("foo")) != 0 {
+		t.Errorf("Expected a successful login to clear foo's failures, but have %v", pm.failures)
+	}
+	if s.lockedOut(ipSubject(sess.ip)) == 0 {
+		t.Errorf("Expected a successful login to leave %s locked out", sess.ip)
+	}
+}
+
+func TestLoginLockoutMidSession(t *testing.T) {
+	pm := failingPlayerMgr{failures: map[string]entity.LoginFailures{}}
+	s := NewServer(Config{MaxLoginFailures: 5, LockoutFailures: 2, LockoutDuration: time.Minute}, nil, nil, pm)
+
+	// a different username each time, so only the address gets locked out
+	sess := newLoginSession(t)
+	loginSteps(s, sess, "", "foo", "wrong", "bar", "wrong")
+	if s.lockedOut(ipSubject(sess.ip)) == 0 {
+		t.Fatalf("Expected %s to be locked out, failures are %v", sess.ip, pm.failures)
+	}
+	if sess.player.LoginState != entity.LoginStateMaxFailed {
+		t.Errorf("Expected the connection to be turned away once its address was locked out, but state is %s", sess.player.LoginState)
+	}
+}
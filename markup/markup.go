@@ -0,0 +1,84 @@
+// Package markup implements the inline colour codes used in game text.
+//
+// A code is a single letter in braces. Lower case letters give the normal
+// colour and upper case the bright version:
+//
+//	{k} black  {r} red      {g} green  {y} yellow
+//	{b} blue   {m} magenta  {c} cyan   {w} white
+//
+// {x} goes back to the default colour and {{ produces a literal brace.
+// Anything else in braces is left alone.
+package markup
+
+import (
+	"strings"
+)
+
+const reset = "\x1b[0m"
+
+var colours = map[byte]string{
+	'k': "30",
+	'r': "31",
+	'g': "32",
+	'y': "33",
+	'b': "34",
+	'm': "35",
+	'c': "36",
+	'w': "37",
+}
+
+// code Returns the ANSI sequence for a markup letter, if it is one.
+func code(letter byte) (string, bool) {
+	if letter == 'x' || letter == 'X' {
+		return reset, true
+	}
+	bright := letter >= 'A' && letter <= 'Z'
+	if bright {
+		letter = letter - 'A' + 'a'
+	}
+	c, ok := colours[letter]
+	if !ok {
+		return "", false
+	}
+	if bright {
+		return "\x1b[1;" + c + "m", true
+	}
+	return "\x1b[0;" + c + "m", true
+}
+
+// Render Convert markup in s to ANSI escape sequences, or remove it entirely
+// if ansi is false.
+func Render(s string, ansi bool) string {
+	if strings.IndexByte(s, '{') < 0 {
+		return s
+	}
+	var out strings.Builder
+	out.Grow(len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] != '{' || i+1 >= len(s) {
+			out.WriteByte(s[i])
+			continue
+		}
+		if s[i+1] == '{' {
+			out.WriteByte('{')
+			i++
+			continue
+		}
+		if i+2 < len(s) && s[i+2] == '}' {
+			if seq, ok := code(s[i+1]); ok {
+				if ansi {
+					out.WriteString(seq)
+				}
+				i += 2
+				continue
+			}
+		}
+		out.WriteByte(s[i])
+	}
+	return out.String()
+}
+
+// Strip Remove all markup from s, leaving the plain text.
+func Strip(s string) string {
+	return Render(s, false)
+}
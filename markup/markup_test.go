@@ -0,0 +1,27 @@
+package markup
+
+import (
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		in    string
+		ansi  string
+		plain string
+	}{
+		{"plain text", "plain text", "plain text"},
+		{"{r}red{x}", "\x1b[0;31mred\x1b[0m", "red"},
+		{"{R}bright{x} and {c}cyan", "\x1b[1;31mbright\x1b[0m and \x1b[0;36mcyan", "bright and cyan"},
+		{"{{r} is literal", "{r} is literal", "{r} is literal"},
+		{"{q} {ab} {", "{q} {ab} {", "{q} {ab} {"},
+	}
+	for _, test := range tests {
+		if got := Render(test.in, true); got != test.ansi {
+			t.Errorf("Render(%q, true) should be %q but got %q", test.in, test.ansi, got)
+		}
+		if got := Strip(test.in); got != test.plain {
+			t.Errorf("Strip(%q) should be %q but got %q", test.in, test.plain, got)
+		}
+	}
+}
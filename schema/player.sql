@@ -1,6 +1,24 @@
 CREATE TABLE IF NOT EXISTS player (
 	   username TEXT PRIMARY KEY,
 	   password TEXT NOT NULL,
-	   actor_id TEXT NOT NULL UNIQUE,
-	   active boolean
+	   actor_id TEXT UNIQUE, -- NULL until the player makes a character
+	   active boolean,
+	   color boolean NOT NULL DEFAULT true,
+	   width INTEGER NOT NULL DEFAULT 0,
+	   role TEXT NOT NULL DEFAULT 'player' -- player, builder, admin or owner
+);
+
+CREATE TABLE IF NOT EXISTS player_key (
+	   username TEXT NOT NULL,
+	   key TEXT NOT NULL,
+	   PRIMARY KEY (username, key),
+	   FOREIGN KEY (username) REFERENCES player (username)
+);
+
+-- recent failed logins, by "user:<username>" or "ip:<address>"
+CREATE TABLE IF NOT EXISTS login_failure (
+	   subject TEXT PRIMARY KEY,
+	   failures INTEGER NOT NULL,
+	   last_failure INTEGER NOT NULL, -- unix time
+	   locked_until INTEGER NOT NULL
 );
@@ -1 +1,2 @@
-INSERT INTO player (username, password, actor_id, active) values ('foo', '', 'A1', false);
+-- foo's password is "password"
+INSERT INTO player (username, password, actor_id, active, role) values ('foo', '$2a$10$DMIOVjqMEcGF19aOJ56ApukzW3.DLP4PBnHKcMhX4v0Z0mjQDG3yK', 'A1', false, 'owner');
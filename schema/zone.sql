@@ -4,7 +4,10 @@ CREATE TABLE IF NOT EXISTS thing (
 	   title TEXT NOT NULL,
 	   description TEXT NOT NULL,
 	   location TEXT NOT NULL,
-	   flags INTEGER NOT NULL
+	   flags TEXT NOT NULL DEFAULT '',
+	   keywords TEXT NOT NULL DEFAULT '',
+	   wear_on TEXT NOT NULL DEFAULT '',
+	   slot TEXT NOT NULL DEFAULT ''
 );
 
 CREATE TABLE IF NOT EXISTS actor (
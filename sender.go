@@ -0,0 +1,362 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	entity "rob.co/textcrawl/entity"
+	"rob.co/textcrawl/markup"
+)
+
+// A Sender owns the outgoing half of a connection. Writes are queued and sent
+// from doSend so that a slow client can't stall the engine. If more than
+// maxBacklog bytes pile up waiting, the client isn't keeping up and is dropped.
+// Text written to it has its colour markup rendered (or stripped) and is
+// word-wrapped to the client's terminal width.
+type Sender struct {
+	wake        chan struct{} // tells doSend there's something in pending
+	pending     []outgoing
+	backlog     int // bytes in pending
+	conn        net.Conn
+	mu          sync.Mutex
+	closed      bool
+	quit        atomic.Bool // whether the player chose to leave, rather than being cut off
+	wrap        wrapper
+	clientWidth int          // what the client told us via NAWS, if anything
+	ansi        bool         // whether the client has told us it understands colour
+	gmcp        bool         // whether the client has agreed to GMCP
+	prefs       entity.Prefs // what the player asked for, which trumps the client
+	onPrefs     func(entity.Prefs)
+	compressing bool // whether we've asked doSend to compress (MCCP2)
+	stats       compressStats
+}
+
+// What doSend should do with a queued item
+type sendKind int
+
+const (
+	sendData          sendKind = iota // write the data
+	sendStartCompress                 // compress everything after this
+	sendStopCompress                  // end the compressed stream and go back to plain
+)
+
+type outgoing struct {
+	kind sendKind
+	data []byte
+}
+
+// How many bytes can be waiting to go out before we give up on the client
+const maxBacklog = 64 * 1024
+
+func NewSender(conn net.Conn) *Sender {
+	return &Sender{
+		wake:  make(chan struct{}, 1),
+		conn:  conn,
+		wrap:  wrapper{width: defaultWidth},
+		prefs: entity.DefaultPrefs(),
+	}
+}
+
+// Write Queue text for the client, rendering colour and wrapping it to their width.
+func (s *Sender) Write(p []byte) (n int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	text := markup.Render(string(p), s.ansi && s.prefs.Color)
+	if err := s.queue(s.wrap.wrap([]byte(text))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// WriteRaw Queue bytes for the client exactly as they are. This is for
+// protocol traffic like telnet negotiation, which mustn't be wrapped.
+func (s *Sender) WriteRaw(p []byte) (n int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pCopy := make([]byte, len(p))
+	copy(pCopy, p)
+	if err := s.queue(pCopy); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Width The width we're currently wrapping to.
+func (s *Sender) Width() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.wrap.width
+}
+
+// SetWidth Override the terminal width. Zero goes back to whatever the client reports.
+func (s *Sender) SetWidth(width int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.prefs.Width = width
+	s.updateWidth()
+	s.prefsChanged()
+}
+
+// Color Whether the player wants colour.
+func (s *Sender) Color() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.prefs.Color
+}
+
+// SetColor Turn colour on or off for this player.
+func (s *Sender) SetColor(on bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.prefs.Color = on
+	s.prefsChanged()
+}
+
+// ColorSupported Whether the client has told us it can display colour.
+func (s *Sender) ColorSupported() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ansi
+}
+
+func (s *Sender) setColorSupported(ansi bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ansi = ansi
+}
+
+func (s *Sender) setGMCP(on bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.gmcp = on
+}
+
+// SendGMCP Send a GMCP message, if the client wants them.
+// data is encoded as JSON; nil sends just the package name.
+func (s *Sender) SendGMCP(pkg string, data any) error {
+	msg := []byte(pkg)
+	if data != nil {
+		encoded, err := json.Marshal(data)
+		if err != nil {
+			return fmt.Errorf("unable to encode GMCP %s: %w", pkg, err)
+		}
+		msg = append(append(msg, ' '), encoded...)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.gmcp {
+		return nil
+	}
+	return s.queue(subnegotiation(optGMCP, msg))
+}
+
+// usePrefs Apply a player's saved settings. onChange is called whenever they
+// change them from then on.
+func (s *Sender) usePrefs(prefs entity.Prefs, onChange func(entity.Prefs)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.prefs = prefs
+	s.onPrefs = onChange
+	s.updateWidth()
+}
+
+// prefsChanged Must hold mu.
+func (s *Sender) prefsChanged() {
+	if s.onPrefs != nil {
+		s.onPrefs(s.prefs)
+	}
+}
+
+// setClientWidth Record the width the client reported.
+func (s *Sender) setClientWidth(width int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clientWidth = width
+	s.updateWidth()
+}
+
+func (s *Sender) updateWidth() {
+	width := defaultWidth
+	if s.prefs.Width > 0 {
+		width = s.prefs.Width
+	} else if s.clientWidth > 0 {
+		width = s.clientWidth
+	}
+	if width < minWidth {
+		width = minWidth
+	} else if width > maxWidth {
+		width = maxWidth
+	}
+	s.wrap.width = width
+}
+
+// lineReceived Note that the client sent us a line. Their enter key put the
+// cursor back at the start of a line, so that's where we're writing now.
+func (s *Sender) lineReceived() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.wrap.col = 0
+}
+
+// queue Hand p to doSend. Must hold mu.
+func (s *Sender) queue(pCopy []byte) error {
+	return s.queueItem(outgoing{kind: sendData, data: pCopy})
+}
+
+// queueItem Must hold mu.
+func (s *Sender) queueItem(item outgoing) error {
+	if s.closed {
+		return net.ErrClosed
+	}
+	if s.backlog+len(item.data) > maxBacklog {
+		log.Printf("Backing up too much on connection. Dropping connection")
+		s.closeLocked()
+		return net.ErrClosed
+	}
+	s.pending = append(s.pending, item)
+	s.backlog += len(item.data)
+	select {
+	case s.wake <- struct{}{}:
+	default:
+		// doSend has already been woken and will pick this up too
+	}
+	return nil
+}
+
+// takePending Everything queued since doSend last looked, and whether the
+// sender has been closed.
+func (s *Sender) takePending() ([]outgoing, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	items := s.pending
+	s.pending = nil
+	s.backlog = 0
+	return items, s.closed
+}
+
+// startCompression Begin an MCCP2 compressed stream. The client has to be told
+// first, in plain text, and everything after that is compressed.
+func (s *Sender) startCompression() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.compressing {
+		return
+	}
+	if err := s.queue(subnegotiation(optMCCP2, nil)); err != nil {
+		return
+	}
+	if err := s.queueItem(outgoing{kind: sendStartCompress}); err == nil {
+		s.compressing = true
+	}
+}
+
+// stopCompression End the compressed stream.
+func (s *Sender) stopCompression() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.compressing {
+		return
+	}
+	if err := s.queueItem(outgoing{kind: sendStopCompress}); err == nil {
+		s.compressing = false
+	}
+}
+
+func (s *Sender) doSend() {
+	defer func() {
+		err := s.conn.Close()
+		if err != nil {
+			log.Printf("Could not close the socket either!")
+		}
+		if in, out := s.stats.totals(); in > 0 {
+			log.Printf("Compressed %d bytes to %d for %s (%.1f%%)",
+				in, out, s.conn.RemoteAddr(), 100*float64(out)/float64(in))
+		}
+	}()
+	var z *compressor
+	toSend := []byte{}
+	for {
+		<-s.wake
+		// Take everything that's waiting, so that a command's whole response,
+		// up to and including the prompt, is compressed and flushed in one go.
+		items, closed := s.takePending()
+		if len(items) == 0 {
+			if closed {
+				break
+			}
+			continue
+		}
+		for _, item := range items {
+			switch item.kind {
+			case sendData:
+				if z != nil {
+					z.write(item.data)
+				} else {
+					toSend = append(toSend, item.data...)
+				}
+			case sendStartCompress:
+				if z == nil {
+					z = newCompressor(&s.stats)
+				}
+			case sendStopCompress:
+				if z != nil {
+					toSend = append(toSend, z.finish()...)
+					z = nil
+				}
+			}
+		}
+		if z != nil {
+			toSend = append(toSend, z.flush()...)
+		}
+		err := s.conn.SetWriteDeadline(time.Now().Add(time.Second))
+		if err != nil {
+			log.Printf("Attempt to set write deadling failed: %s", err)
+			s.Close()
+			break
+		}
+		n, err := s.conn.Write(toSend)
+		if err != nil {
+			log.Printf("Error writing to connection: %s", err)
+			s.Close()
+			break
+		}
+		toSend = toSend[n:]
+		if len(toSend) > 5000 {
+			log.Printf("Backing up too much on connection. Dropping connection")
+			s.Close()
+			break
+		}
+	}
+}
+
+// Quit Close the connection because the player asked to leave.
+func (s *Sender) Quit() {
+	s.quit.Store(true)
+	_ = s.Close()
+}
+
+// Quitting Whether the player asked to leave.
+func (s *Sender) Quitting() bool {
+	return s.quit.Load()
+}
+
+// Close Stop accepting writes. Anything already queued is still sent,
+// then the connection is closed.
+func (s *Sender) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closeLocked()
+	return nil
+}
+
+func (s *Sender) closeLocked() {
+	if !s.closed {
+		s.closed = true
+		close(s.wake)
+	}
+}
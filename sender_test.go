@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestSenderManyWrites(t *testing.T) {
+	server, client := net.Pipe()
+	s := NewSender(server)
+	go s.doSend()
+	received := make(chan []byte)
+	go func() {
+		b, _ := io.ReadAll(client)
+		received <- b
+	}()
+
+	// a look in a room full of things is a write per line
+	var want bytes.Buffer
+	for i := 0; i < 200; i++ {
+		line := fmt.Sprintf("  a gold coin %d\n", i)
+		want.WriteString(line)
+		if _, err := s.Write([]byte(line)); err != nil {
+			t.Fatalf("Expected write %d to be queued, got %s", i, err)
+		}
+	}
+	s.Close()
+	if got := <-received; !bytes.Equal(got, want.Bytes()) {
+		t.Errorf("Expected all 200 lines, got %d bytes of %d", len(got), want.Len())
+	}
+}
+
+func TestSenderDropsStalledClient(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+	s := NewSender(server)
+	// nothing reads from client, and doSend isn't running, so everything backs up
+	line := strings.Repeat("x", 70) + "\n"
+	var err error
+	for i := 0; i <= maxBacklog/len(line) && err == nil; i++ {
+		_, err = s.Write([]byte(line))
+	}
+	if err == nil {
+		t.Fatal("Expected the client to be dropped once the backlog was full")
+	}
+	if _, err := s.Write([]byte("more")); err == nil {
+		t.Error("Expected writes after dropping the client to fail")
+	}
+}
+
+func TestSenderQuit(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+	s := NewSender(server)
+	if s.Quitting() {
+		t.Fatal("Expected a new connection not to be quitting")
+	}
+	s.Quit()
+	if !s.Quitting() {
+		t.Error("Expected the connection to be quitting")
+	}
+	if _, err := s.Write([]byte("bye")); err == nil {
+		t.Error("Expected writes after quitting to fail")
+	}
+}
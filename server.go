@@ -1,180 +1,593 @@
 package main
 
 import (
+	"fmt"
 	"log"
 	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	entity "rob.co/textcrawl/entity"
 )
 
-type Sender struct {
-	ch   chan []byte
-	conn net.Conn
+// A Session is everything we know about one client connection.
+type Session struct {
+	conn   net.Conn
+	sender *Sender
+	telnet *telnet
+	player entity.Player
+	ttypes []string // terminal types the client has reported, in order
+	secure bool     // whether the connection is encrypted
+	ip     string   // where the connection comes from, for lockouts
+	newPwd string   // a new password, while we wait for the player to confirm it
+	passwd passwdStep
+	draft  *characterDraft // the character being created, if any
+	// set when someone else has logged in as this player and taken over, so that
+	// dropping this connection doesn't log them out
+	usurped atomic.Bool
 }
 
-func NewSender(conn net.Conn) Sender {
-	ch := make(chan []byte, 30)
-	return Sender{
-		ch:   ch,
-		conn: conn,
+func newSession(conn net.Conn) *Session {
+	sender := NewSender(conn)
+	sess := &Session{
+		conn:   conn,
+		sender: sender,
+		telnet: newTelnet(rawWriter{sender}),
+		player: entity.NewPlayer(),
+		secure: isSecure(conn),
+		ip:     remoteIP(conn),
 	}
+	sess.telnet.supportThem[optNAWS] = true
+	sess.telnet.supportThem[optTTYPE] = true
+	sess.telnet.supportUs[optGMCP] = true
+	sess.telnet.supportUs[optMCCP2] = true
+	sess.telnet.onOption = sess.optionChanged
+	sess.telnet.onSubneg = sess.subnegotiation
+	return sess
 }
 
-func (s Sender) Write(p []byte) (n int, err error) {
-	pCopy := make([]byte, len(p))
-	s.ch <- pCopy
-	return len(pCopy), nil
+// rawWriter Lets the telnet layer write through a Sender without being wrapped.
+type rawWriter struct {
+	s *Sender
 }
 
-func (s Sender) doSend() {
-	toSend := []byte{}
-	for {
-		p, ok := <-s.ch
-		if !ok {
-			s.Close()
-			break
-		}
-		toSend = append(toSend, p...)
-		err := s.conn.SetWriteDeadline(time.Now().Add(time.Second))
-		if err != nil {
-			log.Printf("Attempt to set write deadling failed: %s", err)
-			s.Close()
-			break
+func (w rawWriter) Write(p []byte) (int, error) {
+	return w.s.WriteRaw(p)
+}
+
+// negotiate Offer the client the options we'd like to use.
+func (sess *Session) negotiate() {
+	sess.telnet.Request(optNAWS)
+	sess.telnet.Request(optTTYPE)
+	sess.telnet.Enable(optGMCP)
+	sess.telnet.Enable(optMCCP2)
+}
+
+// optionChanged Follow up on options the client has agreed to.
+func (sess *Session) optionChanged(opt byte, local bool, enabled bool) {
+	switch {
+	case opt == optTTYPE && !local && enabled:
+		sess.telnet.Subnegotiate(optTTYPE, []byte{ttypeSend})
+	case opt == optGMCP && local:
+		sess.sender.setGMCP(enabled)
+	case opt == optMCCP2 && local && enabled:
+		sess.sender.startCompression()
+	case opt == optMCCP2 && local && !enabled:
+		sess.sender.stopCompression()
+	}
+}
+
+// subnegotiation Handle the details the client sends us about options we've agreed on.
+func (sess *Session) subnegotiation(opt byte, data []byte) {
+	switch opt {
+	case optNAWS:
+		// width and height, as 16 bit big endian numbers
+		if len(data) != 4 {
+			log.Printf("Ignoring malformed NAWS from %s", sess.conn.RemoteAddr())
+			return
 		}
-		n, err := s.conn.Write(toSend)
-		if err != nil {
-			log.Printf("Error writing to connection: %s", err)
-			s.Close()
-			break
+		width := int(data[0])<<8 | int(data[1])
+		// some clients send zero when they don't know
+		if width > 0 {
+			sess.sender.setClientWidth(width)
 		}
-		toSend = toSend[n:]
-		if len(toSend) > 5000 {
-			log.Printf("Backing up too much on connection. Dropping connection")
-			s.Close()
-			break
+	case optTTYPE:
+		if len(data) == 0 || data[0] != ttypeIs {
+			return
 		}
+		sess.terminalType(string(data[1:]))
+	case optGMCP:
+		// Core.Hello, Core.Supports.Set and so on. We send everything we have
+		// regardless of what the client claims to support, so just note it.
+		log.Printf("GMCP from %s: %s", sess.conn.RemoteAddr(), data)
 	}
 }
 
-func (s Sender) Close() {
-	err := s.conn.Close()
-	if err != nil {
-		print("Could not close the socket either!")
+// terminalType Handle one reply to TTYPE SEND. MTTS clients give a different
+// answer each time we ask (client name, terminal type, then "MTTS <bits>"),
+// and repeat the last one once they've run out, so we keep asking until then.
+func (sess *Session) terminalType(ttype string) {
+	seen := len(sess.ttypes) > 0 && sess.ttypes[len(sess.ttypes)-1] == ttype
+	sess.ttypes = append(sess.ttypes, ttype)
+	if ttypeSupportsColor(ttype) {
+		sess.sender.setColorSupported(true)
+	}
+	if !seen && len(sess.ttypes) < maxTTypes && !strings.HasPrefix(ttype, "MTTS ") {
+		sess.telnet.Subnegotiate(optTTYPE, []byte{ttypeSend})
+		return
 	}
-	close(s.ch)
+	log.Printf("Client %s reports terminal types %v", sess.conn.RemoteAddr(), sess.ttypes)
 }
 
 type Server struct {
+	config    Config
 	msgChan   chan Message
 	reqChan   chan Request
+	connsMu   sync.Mutex
 	conns     []net.Conn
+	sessions  map[string]*Session // logged in sessions, by username
 	playerMgr entity.PlayerMgr
 }
 
-func NewServer(msgChan chan Message, reqChan chan Request, playerMgr entity.PlayerMgr) *Server {
+func NewServer(config Config, msgChan chan Message, reqChan chan Request, playerMgr entity.PlayerMgr) *Server {
 	return &Server{
+		config:    config,
 		msgChan:   msgChan,
 		reqChan:   reqChan,
 		conns:     make([]net.Conn, 0),
+		sessions:  make(map[string]*Session),
 		playerMgr: playerMgr,
 	}
 }
 
 func (s *Server) Serve() {
-	ln, err := net.Listen("tcp", ":8888")
+	go s.serveWeb(s.config.WebAddr)
+	if s.config.TLSAddr != "" {
+		go s.serveTLS()
+	}
+	if s.config.SSHAddr != "" {
+		go s.serveSSH()
+	}
+	ln, err := net.Listen("tcp", s.config.TelnetAddr)
 	if err != nil {
 		panic(err)
 	}
+	s.accept(ln)
+}
+
+// accept Start a session for every connection on ln.
+func (s *Server) accept(ln net.Listener) {
 	for {
 		conn, err := ln.Accept()
 		if err != nil {
 			log.Printf("Error accepting connection: %svr", err)
 			continue
 		}
-		s.conns = append(s.conns, conn)
 		go s.handleConnection(conn)
 	}
 }
 
+// track Keep a list of open connections. Listeners run in their own
+// goroutines, so this needs to be locked.
+func (s *Server) track(conn net.Conn) {
+	s.connsMu.Lock()
+	defer s.connsMu.Unlock()
+	s.conns = append(s.conns, conn)
+}
+
+func (s *Server) untrack(conn net.Conn) {
+	s.connsMu.Lock()
+	defer s.connsMu.Unlock()
+	for i, c := range s.conns {
+		if c == conn {
+			s.conns = append(s.conns[:i], s.conns[i+1:]...)
+			return
+		}
+	}
+}
+
+// register Note that sess is playing as its player, taking over from any
+// other session that was.
+func (s *Server) register(sess *Session) {
+	s.connsMu.Lock()
+	old := s.sessions[sess.player.Username]
+	s.sessions[sess.player.Username] = sess
+	s.connsMu.Unlock()
+	if old != nil && old != sess {
+		log.Printf("INFO: %s has taken over their session from %s", sess.player.Username, old.ip)
+		old.usurped.Store(true)
+		_, _ = old.sender.Write([]byte("\nYou have logged in from somewhere else. Goodbye!\n"))
+		_ = old.sender.Close()
+	}
+}
+
+func (s *Server) unregister(sess *Session) {
+	s.connsMu.Lock()
+	defer s.connsMu.Unlock()
+	if s.sessions[sess.player.Username] == sess {
+		delete(s.sessions, sess.player.Username)
+	}
+}
+
+// handleConnection Run a session on conn until it closes. This is the same for
+// every kind of listener; they just have to give us something that acts like a socket.
 func (s *Server) handleConnection(conn net.Conn) {
-	defer conn.Close()
 	log.Printf("Got a connection from %svr", conn.RemoteAddr())
 	// TODO: for now using IP address, not sure what should really be done
 
-	// The player object "lives" in this loop.
-	player := entity.NewPlayer()
-	// TODO: do we want to do this?
-	//s.msgChan <- NewMessage(Connect, player, conn)
+	sess := newSession(conn)
+	s.runSession(sess, func() {
+		// Get the login started without waiting for the client to say something
+		sess.negotiate()
+		sess.player = s.doLogin(sess, NewRequest(sess.player, sess.sender, ""))
+	})
+}
+
+// runSession Call start, then feed input from the session's connection to the
+// login flow or the engine until the connection drops.
+func (s *Server) runSession(sess *Session, start func()) {
+	conn := sess.conn
+	s.track(conn)
+	defer s.untrack(conn)
+	defer s.unregister(sess)
+	defer conn.Close()
+
+	// The session, and the player in it, "lives" in this loop.
+	go sess.sender.doSend()
+	defer sess.sender.Close()
+	start()
 
 	// Loop forever, processing input from the user. Break if the
 	// connection drops.
-	received := []byte{}
 	buf := make([]byte, 500)
 	for {
 		n, err := conn.Read(buf)
 		if err != nil {
 			log.Printf("Got connection read error: %s", err)
-			if player.LoginState == entity.LoginStateLoggedIn {
-				s.msgChan <- NewMessage(Disconnect, player, nil)
+			if sess.player.LoginState == entity.LoginStateLoggedIn && !sess.usurped.Load() {
+				left := Disconnect
+				if sess.sender.Quitting() {
+					left = Quit
+				}
+				s.msgChan <- NewMessage(left, sess.player, nil)
 			}
 			break
 		}
-		received = append(received, buf[:n]...)
-		if len(received) > 1000 {
+		lines := sess.telnet.Feed(buf[:n])
+		if sess.telnet.Overflowed() {
 			log.Printf("Request too large. Killing connection")
-			if player.LoginState == entity.LoginStateLoggedIn {
-				s.msgChan <- NewMessage(Disconnect, player, nil)
+			if sess.player.LoginState == entity.LoginStateLoggedIn && !sess.usurped.Load() {
+				s.msgChan <- NewMessage(Disconnect, sess.player, nil)
 			}
 			break
 		}
-		if len(received) >= 2 && received[len(received)-2] == '\r' && received[len(received)-1] == '\n' {
-			text := string(received[:len(received)-2])
-			req := NewRequest(player, conn, text)
-			if player.LoginState == entity.LoginStateLoggedIn {
-				s.reqChan <- req
-			} else {
-				player = s.doLogin(req)
-				if player.LoginState == entity.LoginStateLoggedIn {
-					// clear out password and send req on to the engine so that it can issue a prompt
-					s.msgChan <- NewMessage(Connect, player, conn)
-					req.Text = ""
-					req.Player = player
-					s.reqChan <- req
-				}
+		for _, text := range lines {
+			s.handleLine(sess, text)
+		}
+	}
+}
 
-			}
-			received = []byte{}
+// handleLine Deal with one line of input, either passing it to the engine or
+// using it to move the login along.
+func (s *Server) handleLine(sess *Session, text string) {
+	sess.sender.lineReceived()
+	req := NewRequest(sess.player, sess.sender, text)
+	if sess.player.LoginState == entity.LoginStateLoggedIn {
+		if sess.passwd != passwdNone || strings.EqualFold(strings.TrimSpace(text), "password") {
+			s.changePassword(sess, req)
+			return
+		}
+		s.reqChan <- req
+		return
+	}
+	before := hidesInput(sess.player.LoginState)
+	if before {
+		// the client didn't echo their enter key either
+		req.Write("\n")
+	}
+	sess.player = s.doLogin(sess, req)
+	after := hidesInput(sess.player.LoginState)
+	if before != after {
+		sess.hideInput(after)
+	}
+	if sess.player.LoginState == entity.LoginStateLoggedIn {
+		s.enterGame(sess)
+	}
+}
+
+// hidesInput Whether the player is typing a password in this state.
+func hidesInput(state entity.LoginState) bool {
+	return state == entity.LoginStateWantPwd ||
+		state == entity.LoginStateNewPwd ||
+		state == entity.LoginStateConfirmPwd
+}
+
+// hideInput Ask the client not to echo what's typed, so passwords aren't left on screen.
+func (sess *Session) hideInput(hide bool) {
+	if c, ok := sess.conn.(*sshConn); ok {
+		// there's no telnet over SSH; we do the echoing ourselves
+		c.setHidden(hide)
+		return
+	}
+	if hide {
+		sess.telnet.Enable(optEcho)
+	} else {
+		sess.telnet.Disable(optEcho)
+	}
+}
+
+// enterGame Hand a freshly logged in player over to the engine.
+func (s *Server) enterGame(sess *Session) {
+	s.register(sess)
+	s.loadPrefs(sess)
+	role, err := s.playerMgr.LoadRole(sess.player.Username)
+	if err != nil {
+		log.Printf("WARN: unable to load role for %s: %s", sess.player.Username, err)
+	}
+	sess.player.Role = role
+	s.msgChan <- NewMessage(Connect, sess.player, sess.sender)
+	// send an empty request (rather than the password!) on to the engine so that it can issue a prompt
+	s.reqChan <- NewRequest(sess.player, sess.sender, "")
+}
+
+// loadPrefs Apply the player's saved settings to their connection and save
+// them whenever they're changed.
+func (s *Server) loadPrefs(sess *Session) {
+	username := sess.player.Username
+	prefs, err := s.playerMgr.LoadPrefs(username)
+	if err != nil {
+		log.Printf("WARN: unable to load preferences for %s: %s", username, err)
+	}
+	sess.sender.usePrefs(prefs, func(p entity.Prefs) {
+		if err := s.playerMgr.SavePrefs(username, p); err != nil {
+			log.Printf("WARN: unable to save preferences for %s: %s", username, err)
 		}
+	})
+}
+
+// refuseLockedIP Turn the connection away if its address is locked out. Returns whether it was.
+func (e *Server) refuseLockedIP(sess *Session, req Request) bool {
+	wait := e.lockedOut(ipSubject(sess.ip))
+	if wait == 0 {
+		return false
 	}
+	log.Printf("LOGIN REFUSED ip=%s is locked out", sess.ip)
+	req.Write(fmt.Sprintf("Too many failed logins from your address. Please try again in %s.\n", formatWait(wait)))
+	_ = sess.sender.Close()
+	return true
 }
 
-func (e *Server) doLogin(req Request) entity.Player {
+func (e *Server) doLogin(sess *Session, req Request) entity.Player {
+	text := strings.TrimSpace(req.Text)
 	switch req.Player.LoginState {
 	case entity.LoginStateStart:
-		req.Write("Please enter your username: ")
+		if e.refuseLockedIP(sess, req) {
+			return req.Player
+		}
+		req.Write("Please enter your username, or \"new\" to create an account: ")
 		req.Player.LoginState = entity.LoginStateWantUser
-	case entity.LoginStateWantUser:
-		if req.Text != "" {
-			req.Player.Username = req.Text
-			req.Write("Please enter your password: ")
-			req.Player.LoginState = entity.LoginStateWantPwd
+	case entity.LoginStateWantUser, entity.LoginStateFailed:
+		if text == "" {
+			break
 		}
+		if strings.EqualFold(text, "new") {
+			req.Write("What name would you like? ")
+			req.Player.LoginState = entity.LoginStateNewUser
+			break
+		}
+		req.Player.Username = strings.ToLower(text)
+		if wait := e.lockedOut(userSubject(req.Player.Username)); wait > 0 {
+			log.Printf("LOGIN REFUSED user=%q ip=%s, user is locked out", req.Player.Username, sess.ip)
+			req.Write(fmt.Sprintf("That account is locked after too many failed logins. Please try again in %s.\n",
+				formatWait(wait)))
+			_ = sess.sender.Close()
+			return req.Player
+		}
+		if !e.passwordsAllowed(sess, req) {
+			return req.Player
+		}
+		req.Write("Please enter your password: ")
+		req.Player.LoginState = entity.LoginStateWantPwd
 	case entity.LoginStateWantPwd:
-		if req.Text != "" {
-			// TODO: for now, we don't actually have passwords!
-			actorId, err := e.playerMgr.LookupPlayer(req.Player.Username, "")
-			if err != nil {
-				log.Printf("Player lookup failed: %s", err)
-				req.Write("I'm sorry...who?")
-				req.Write("\n> ")
-				req.Player.LoginAttempts++
-			} else {
-				req.Write("Login successful\n")
-				req.Player.ActorId = actorId
-				req.Player.LoginState = entity.LoginStateLoggedIn
+		if req.Text == "" {
+			break
+		}
+		actorId, err := e.playerMgr.LookupPlayer(req.Player.Username, req.Text)
+		switch {
+		case err == entity.ErrAlreadyLoggedIn:
+			e.loginSucceeded(sess.ip, req.Player.Username)
+			req.Player.ActorId = actorId
+			return e.askUsurp(req)
+		case err != nil:
+			if err != entity.ErrBadLogin {
+				log.Printf("WARN: player lookup failed: %s", err)
+			}
+			req.Player.LoginAttempts++
+			time.Sleep(e.loginFailed(sess.ip, req.Player.Username))
+			if req.Player.LoginAttempts >= e.config.MaxLoginFailures {
+				log.Printf("LOGIN DISCONNECT ip=%s after %d failures", sess.ip, req.Player.LoginAttempts)
+				req.Write("Invalid username or password. Too many failed attempts, goodbye.\n")
+				req.Player.LoginState = entity.LoginStateMaxFailed
+				_ = sess.sender.Close()
+				break
+			}
+			// this failure may have locked out the address
+			if e.refuseLockedIP(sess, req) {
+				req.Player.LoginState = entity.LoginStateMaxFailed
+				break
 			}
+			req.Write("Invalid username or password.\nPlease enter your username: ")
+			req.Player.LoginState = entity.LoginStateFailed
+		default:
+			e.loginSucceeded(sess.ip, req.Player.Username)
+			if actorId == "" {
+				return e.startCharacter(sess, req)
+			}
+			req.Write("Login successful\n")
+			req.Player.ActorId = actorId
+			req.Player.LoginState = entity.LoginStateLoggedIn
+		}
+	case entity.LoginStateNewUser:
+		if text == "" {
+			break
+		}
+		if err := entity.ValidateUsername(text); err != nil {
+			req.Write(err.Error() + ". What name would you like? ")
+			break
+		}
+		username := strings.ToLower(text)
+		exists, err := e.playerMgr.PlayerExists(username)
+		if err != nil {
+			log.Printf("WARN: unable to check for player %s: %s", username, err)
+			req.Write("Something went wrong. What name would you like? ")
+			break
+		}
+		if exists {
+			req.Write(entity.ErrPlayerExists.Error() + ". What name would you like? ")
+			break
+		}
+		req.Player.Username = username
+		if !e.passwordsAllowed(sess, req) {
+			return req.Player
+		}
+		req.Write("Choose a password: ")
+		req.Player.LoginState = entity.LoginStateNewPwd
+	case entity.LoginStateNewPwd:
+		if err := entity.ValidatePassword(req.Text); err != nil {
+			req.Write(err.Error() + ". Choose a password: ")
+			break
+		}
+		sess.newPwd = req.Text
+		req.Write("Please type it again: ")
+		req.Player.LoginState = entity.LoginStateConfirmPwd
+	case entity.LoginStateConfirmPwd:
+		pwd := sess.newPwd
+		sess.newPwd = ""
+		if req.Text != pwd {
+			req.Write("Those didn't match. Choose a password: ")
+			req.Player.LoginState = entity.LoginStateNewPwd
+			break
 		}
+		err := e.playerMgr.CreatePlayer(req.Player.Username, pwd)
+		if err == entity.ErrPlayerExists {
+			req.Write("Someone has just taken that name. What name would you like? ")
+			req.Player.LoginState = entity.LoginStateNewUser
+			break
+		}
+		if err != nil {
+			log.Printf("WARN: unable to create player %s: %s", req.Player.Username, err)
+			req.Write("Something went wrong creating your account. Please try again later.\n")
+			_ = sess.sender.Close()
+			break
+		}
+		log.Printf("INFO: registered new player %s", req.Player.Username)
+		req.Write("Your account has been created.\n")
+		return e.startCharacter(sess, req)
+	case entity.LoginStateUsurp:
+		switch strings.ToLower(text) {
+		case "y", "yes":
+			// register, when they enter the game, disconnects the other session
+			req.Write("Taking over.\n")
+			req.Player.LoginState = entity.LoginStateLoggedIn
+		case "n", "no":
+			req.Write("Goodbye!\n")
+			_ = sess.sender.Close()
+		default:
+			req.Write("Please answer yes or no. Take over that session? ")
+		}
+	case entity.LoginStateCharName, entity.LoginStateCharDesc, entity.LoginStateCharStats:
+		return e.doCharacter(sess, req)
 	}
 	return req.Player
 }
+
+// askUsurp Offer a player who's already logged in the chance to take over their
+// other session, say if their connection dropped without us noticing.
+func (e *Server) askUsurp(req Request) entity.Player {
+	req.Write("You are already logged in. Take over that session? (yes/no) ")
+	req.Player.LoginState = entity.LoginStateUsurp
+	return req.Player
+}
+
+// passwordsAllowed Check the connection is fit to send a password over, warning
+// the player if it isn't encrypted. If we require encryption, the connection is closed.
+func (e *Server) passwordsAllowed(sess *Session, req Request) bool {
+	if sess.secure {
+		return true
+	}
+	if e.config.RequireTLS {
+		req.Write("Passwords are only accepted over encrypted connections. Please reconnect using TLS.\n")
+		_ = sess.sender.Close()
+		return false
+	}
+	req.Write("{Y}Warning:{x} this connection is not encrypted, so your password can be seen in transit.\n")
+	return true
+}
+
+// Steps in changing a password. See changePassword.
+type passwdStep int
+
+const (
+	passwdNone    passwdStep = iota // not changing it
+	passwdOld                       // waiting for the current password
+	passwdNew                       // waiting for the new one
+	passwdConfirm                   // waiting for the new one again
+)
+
+// changePassword Handle the "password" command. This happens here rather than in
+// the engine so that the passwords are never queued as commands, and so that we can
+// stop the client echoing them.
+func (s *Server) changePassword(sess *Session, req Request) {
+	if sess.passwd != passwdNone {
+		// they pressed enter, which the client didn't echo
+		req.Write("\n")
+	}
+	switch sess.passwd {
+	case passwdNone:
+		req.Write("Current password: ")
+		sess.passwd = passwdOld
+	case passwdOld:
+		_, err := s.playerMgr.LookupPlayer(sess.player.Username, req.Text)
+		// they're logged in, so they'll always be "already logged in"
+		if err == entity.ErrBadLogin {
+			req.Write("That isn't your password.\n> ")
+			sess.passwd = passwdNone
+			break
+		}
+		if err != nil && err != entity.ErrAlreadyLoggedIn {
+			log.Printf("WARN: unable to check %s's password: %s", sess.player.Username, err)
+			req.Write("Something went wrong. Your password has not been changed.\n> ")
+			sess.passwd = passwdNone
+			break
+		}
+		req.Write("New password: ")
+		sess.passwd = passwdNew
+	case passwdNew:
+		if err := entity.ValidatePassword(req.Text); err != nil {
+			req.Write(err.Error() + ". Your password has not been changed.\n> ")
+			sess.passwd = passwdNone
+			break
+		}
+		sess.newPwd = req.Text
+		req.Write("Please type it again: ")
+		sess.passwd = passwdConfirm
+	case passwdConfirm:
+		pwd := sess.newPwd
+		sess.newPwd = ""
+		sess.passwd = passwdNone
+		if req.Text != pwd {
+			req.Write("Those didn't match. Your password has not been changed.\n> ")
+			break
+		}
+		if err := s.playerMgr.SetPassword(sess.player.Username, pwd); err != nil {
+			log.Printf("WARN: unable to change password for %s: %s", sess.player.Username, err)
+			req.Write("Something went wrong. Your password has not been changed.\n> ")
+			break
+		}
+		log.Printf("INFO: %s changed their password", sess.player.Username)
+		req.Write("Your password has been changed.\n> ")
+	}
+	sess.hideInput(sess.passwd != passwdNone)
+}
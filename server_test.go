@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	entity "rob.co/textcrawl/entity"
+)
+
+// loginSteps Feed lines to doLogin, as handleLine would.
+func loginSteps(s *Server, sess *Session, lines ...string) {
+	for _, line := range lines {
+		sess.player = s.doLogin(sess, NewRequest(sess.player, sess.sender, line))
+	}
+}
+
+func newLoginSession(t *testing.T) *Session {
+	conn, other := net.Pipe()
+	t.Cleanup(func() {
+		_ = conn.Close()
+		_ = other.Close()
+	})
+	sess := newSession(conn)
+	sess.secure = true
+	return sess
+}
+
+func TestRegistration(t *testing.T) {
+	s := NewServer(Config{}, nil, nil, DummyPlayerMgr{})
+	sess := newLoginSession(t)
+	loginSteps(s, sess, "", "new")
+	if sess.player.LoginState != entity.LoginStateNewUser {
+		t.Fatalf("Expected 'new' to start registration, but state is %s", sess.player.LoginState)
+	}
+	// taken, then invalid, then fine
+	loginSteps(s, sess, "foo", "x", "Bar")
+	if sess.player.LoginState != entity.LoginStateNewPwd || sess.player.Username != "bar" {
+		t.Fatalf("Expected to be asked for bar's password, but state is %s for '%s'",
+			sess.player.LoginState, sess.player.Username)
+	}
+	loginSteps(s, sess, "short", "secret1", "secret2")
+	if sess.player.LoginState != entity.LoginStateNewPwd {
+		t.Fatalf("Expected mismatched passwords to be asked for again, but state is %s", sess.player.LoginState)
+	}
+	loginSteps(s, sess, "secret1")
+	if sess.player.LoginState != entity.LoginStateConfirmPwd || sess.newPwd != "secret1" {
+		t.Fatalf("Expected to be asked to confirm, but state is %s", sess.player.LoginState)
+	}
+}
+
+// activePlayerMgr Accepts any password, but says the player is already logged in.
+type activePlayerMgr struct {
+	DummyPlayerMgr
+}
+
+func (pm activePlayerMgr) LookupPlayer(username string, pwd string) (entity.Id, error) {
+	return "A1", entity.ErrAlreadyLoggedIn
+}
+
+func TestUsurp(t *testing.T) {
+	s := NewServer(Config{}, nil, nil, activePlayerMgr{})
+	old := newLoginSession(t)
+	old.player.Username = "foo"
+	s.register(old)
+
+	sess := newLoginSession(t)
+	loginSteps(s, sess, "", "foo", "password")
+	if sess.player.LoginState != entity.LoginStateUsurp || sess.player.ActorId != "A1" {
+		t.Fatalf("Expected to be offered a takeover, but state is %s", sess.player.LoginState)
+	}
+	loginSteps(s, sess, "maybe")
+	if sess.player.LoginState != entity.LoginStateUsurp {
+		t.Fatalf("Expected to be asked again, but state is %s", sess.player.LoginState)
+	}
+	loginSteps(s, sess, "yes")
+	if sess.player.LoginState != entity.LoginStateLoggedIn {
+		t.Fatalf("Expected to be logged in, but state is %s", sess.player.LoginState)
+	}
+	s.register(sess)
+	if !old.usurped.Load() {
+		t.Error("Expected the old session to have been taken over")
+	}
+	s.unregister(old)
+	if s.sessions["foo"] != sess {
+		t.Error("Expected the old session going away not to unregister the new one")
+	}
+}
+
+// brokenPlayerMgr Can't look anyone up.
+type brokenPlayerMgr struct {
+	DummyPlayerMgr
+}
+
+func (pm brokenPlayerMgr) LookupPlayer(username string, pwd string) (entity.Id, error) {
+	return "", errors.New("database is locked")
+}
+
+func TestChangePassword(t *testing.T) {
+	for _, c := range []struct {
+		pm   entity.PlayerMgr
+		want passwdStep
+	}{
+		{activePlayerMgr{}, passwdNew},
+		{brokenPlayerMgr{}, passwdNone},
+	} {
+		s := NewServer(Config{}, nil, nil, c.pm)
+		sess := newLoginSession(t)
+		sess.player.Username = "foo"
+		for _, line := range []string{"password", "secret"} {
+			s.changePassword(sess, NewRequest(sess.player, sess.sender, line))
+		}
+		if sess.passwd != c.want {
+			t.Errorf("Expected %T to leave the change at step %d, got %d", c.pm, c.want, sess.passwd)
+		}
+	}
+}
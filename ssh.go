@@ -0,0 +1,421 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	cmd "rob.co/textcrawl/command"
+	entity "rob.co/textcrawl/entity"
+)
+
+// Keys we keep in ssh.Permissions.Extensions to carry the login through to the session
+const (
+	sshExtActor    = "textcrawl-actor"
+	sshExtUsername = "textcrawl-username"
+	sshExtActive   = "textcrawl-active" // set if they're already logged in elsewhere
+)
+
+// serveSSH Accept SSH connections. Players authenticate with their password or a
+// key they've registered with the "sshkey" command, so there's no login prompt:
+// the session starts with them already in the game.
+func (s *Server) serveSSH() {
+	signer, err := loadHostKey(s.config.SSHHostKey)
+	if err != nil {
+		log.Printf("SSH listener unavailable: %s", err)
+		return
+	}
+	config := &ssh.ServerConfig{
+		PasswordCallback:  s.sshPassword,
+		PublicKeyCallback: s.sshPublicKey,
+		ServerVersion:     "SSH-2.0-textcrawl",
+	}
+	config.AddHostKey(signer)
+	ln, err := net.Listen("tcp", s.config.SSHAddr)
+	if err != nil {
+		log.Printf("SSH listener unavailable: %s", err)
+		return
+	}
+	log.Printf("Serving SSH on %s", s.config.SSHAddr)
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			log.Printf("Error accepting SSH connection: %s", err)
+			continue
+		}
+		go s.handleSSH(conn, config)
+	}
+}
+
+// loadHostKey Load the server's private key from file or, if there isn't one,
+// make one up. A made up key changes every restart, which clients will complain about.
+func loadHostKey(file string) (ssh.Signer, error) {
+	if file != "" {
+		pem, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		return ssh.ParsePrivateKey(pem)
+	}
+	log.Printf("WARN: no SSH host key configured. Using a temporary one, which will change on restart.")
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("unable to generate host key: %w", err)
+	}
+	return ssh.NewSignerFromKey(key)
+}
+
+func (s *Server) sshPassword(meta ssh.ConnMetadata, pwd []byte) (*ssh.Permissions, error) {
+	if len(pwd) == 0 {
+		return nil, errors.New("empty password")
+	}
+	return s.sshLogin(meta, "password", func(username string) (entity.Id, error) {
+		return s.playerMgr.LookupPlayer(username, string(pwd))
+	})
+}
+
+func (s *Server) sshPublicKey(meta ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+	return s.sshLogin(meta, "key", func(username string) (entity.Id, error) {
+		return s.playerMgr.LookupPlayerKey(username, authorizedKey(key))
+	})
+}
+
+// sshLogin Check an SSH login with lookup, under the same lockout rules as any
+// other login. Usernames are lowercase, whatever the client sent.
+func (s *Server) sshLogin(meta ssh.ConnMetadata, how string, lookup func(username string) (entity.Id, error)) (*ssh.Permissions, error) {
+	ip := hostOf(meta.RemoteAddr().String())
+	username := strings.ToLower(meta.User())
+	if s.lockedOut(ipSubject(ip)) > 0 || s.lockedOut(userSubject(username)) > 0 {
+		log.Printf("LOGIN REFUSED user=%q ip=%s over SSH, locked out", username, ip)
+		return nil, errors.New("locked out")
+	}
+	actorId, err := lookup(username)
+	if err == entity.ErrBadLogin {
+		time.Sleep(s.loginFailed(ip, username))
+	}
+	if err != nil && err != entity.ErrAlreadyLoggedIn {
+		log.Printf("SSH %s login for %s from %s failed: %s", how, username, ip, err)
+		return nil, err
+	}
+	s.loginSucceeded(ip, username)
+	return sshPermissions(username, actorId, err == entity.ErrAlreadyLoggedIn), nil
+}
+
+func sshPermissions(username string, actorId entity.Id, active bool) *ssh.Permissions {
+	perms := &ssh.Permissions{
+		Extensions: map[string]string{
+			sshExtUsername: username,
+			sshExtActor:    string(actorId),
+		},
+	}
+	if active {
+		perms.Extensions[sshExtActive] = "yes"
+	}
+	return perms
+}
+
+// authorizedKey The form we store keys in: authorized_keys format without the comment.
+func authorizedKey(key ssh.PublicKey) string {
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))
+}
+
+// handleSSH Do the SSH handshake and run a game session on the first shell the client asks for.
+func (s *Server) handleSSH(conn net.Conn, config *ssh.ServerConfig) {
+	sconn, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		log.Printf("SSH handshake with %s failed: %s", conn.RemoteAddr(), err)
+		_ = conn.Close()
+		return
+	}
+	defer sconn.Close()
+	log.Printf("Got an SSH connection from %s for %s", sconn.RemoteAddr(), sconn.User())
+	go ssh.DiscardRequests(reqs)
+
+	player := entity.NewPlayer()
+	player.Username = sconn.Permissions.Extensions[sshExtUsername]
+	player.ActorId = entity.Id(sconn.Permissions.Extensions[sshExtActor])
+	player.LoginState = entity.LoginStateLoggedIn
+	if player.ActorId == "" {
+		player.LoginState = entity.LoginStateStart
+	}
+	_, active := sconn.Permissions.Extensions[sshExtActive]
+
+	started := false
+	for nc := range chans {
+		if nc.ChannelType() != "session" || started {
+			_ = nc.Reject(ssh.UnknownChannelType, "only one session channel is supported")
+			continue
+		}
+		ch, chReqs, err := nc.Accept()
+		if err != nil {
+			log.Printf("Unable to accept SSH channel from %s: %s", sconn.RemoteAddr(), err)
+			return
+		}
+		started = true
+		go s.sshSession(newSSHConn(ch, sconn), chReqs, player, active)
+	}
+}
+
+// sshSession Wait for the client to ask for a shell, then hand the channel to the
+// same session loop that telnet uses.
+func (s *Server) sshSession(conn *sshConn, reqs <-chan *ssh.Request, player entity.Player, active bool) {
+	sess := newSession(conn)
+	sess.player = player
+	shell := make(chan bool, 1)
+	go func() {
+		for req := range reqs {
+			ok := false
+			switch req.Type {
+			case "pty-req":
+				term, width, ok2 := parsePtyRequest(req.Payload)
+				if ok2 {
+					conn.setPty(true)
+					if ttypeSupportsColor(term) {
+						sess.sender.setColorSupported(true)
+					}
+					if width > 0 {
+						sess.sender.setClientWidth(width)
+					}
+				}
+				ok = ok2
+			case "window-change":
+				if len(req.Payload) >= 4 {
+					if width := int(binary.BigEndian.Uint32(req.Payload)); width > 0 {
+						sess.sender.setClientWidth(width)
+					}
+				}
+				ok = true
+			case "shell":
+				ok = true
+				select {
+				case shell <- true:
+				default:
+				}
+			case "env":
+				ok = true
+			}
+			if req.WantReply {
+				_ = req.Reply(ok, nil)
+			}
+		}
+		close(shell)
+	}()
+	if !<-shell {
+		_ = conn.Close()
+		return
+	}
+	s.runSession(sess, func() {
+		if player.ActorId == "" {
+			// they registered, but never finished making a character
+			sess.player = s.startCharacter(sess, NewRequest(player, sess.sender, ""))
+			return
+		}
+		if active {
+			sess.player = s.askUsurp(NewRequest(player, sess.sender, ""))
+			return
+		}
+		sess.sender.Write([]byte("Welcome back, " + player.Username + ".\n"))
+		s.enterGame(sess)
+	})
+}
+
+// parsePtyRequest Pull the terminal type and width out of a pty-req. See RFC 4254 section 6.2.
+func parsePtyRequest(payload []byte) (string, int, bool) {
+	if len(payload) < 4 {
+		return "", 0, false
+	}
+	n := int(binary.BigEndian.Uint32(payload))
+	payload = payload[4:]
+	if len(payload) < n+4 {
+		return "", 0, false
+	}
+	term := string(payload[:n])
+	width := int(binary.BigEndian.Uint32(payload[n:]))
+	return term, width, true
+}
+
+// An sshConn makes an SSH channel look enough like a socket for a Session.
+// With a pty the client's terminal is in raw mode, so we echo what's typed
+// and send "\r\n" for every newline, which is what a telnet client would do itself.
+type sshConn struct {
+	ch     ssh.Channel
+	conn   ssh.Conn
+	mu     sync.Mutex
+	pty    bool
+	hidden bool // whether a password is being typed, so mustn't be echoed
+	typed  int  // bytes echoed on the current line, so backspace stops at the prompt
+}
+
+func newSSHConn(ch ssh.Channel, conn ssh.Conn) *sshConn {
+	return &sshConn{ch: ch, conn: conn}
+}
+
+func (c *sshConn) setPty(on bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pty = on
+}
+
+func (c *sshConn) setHidden(hidden bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.hidden = hidden
+}
+
+func (c *sshConn) Read(p []byte) (int, error) {
+	n, err := c.ch.Read(p)
+	if n > 0 {
+		c.echo(p[:n])
+	}
+	return n, err
+}
+
+// echo Show the player what they've typed.
+func (c *sshConn) echo(p []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.pty || c.hidden {
+		return
+	}
+	out := make([]byte, 0, len(p))
+	for _, b := range p {
+		switch {
+		case b == '\r' || b == '\n':
+			out = append(out, '\r', '\n')
+			c.typed = 0
+		case b == '\b' || b == 127:
+			if c.typed > 0 {
+				out = append(out, '\b', ' ', '\b')
+				c.typed--
+			}
+		case b < ' ':
+			// other control characters aren't worth showing
+		default:
+			out = append(out, b)
+			c.typed++
+		}
+	}
+	if len(out) > 0 {
+		_, _ = c.ch.Write(out)
+	}
+}
+
+func (c *sshConn) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	pty := c.pty
+	c.mu.Unlock()
+	if !pty {
+		return c.ch.Write(p)
+	}
+	out := make([]byte, 0, len(p)+len(p)/40)
+	for i, b := range p {
+		if b == '\n' && (i == 0 || p[i-1] != '\r') {
+			out = append(out, '\r')
+		}
+		out = append(out, b)
+	}
+	if _, err := c.ch.Write(out); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (c *sshConn) Close() error {
+	return c.ch.Close()
+}
+
+func (c *sshConn) LocalAddr() net.Addr  { return c.conn.LocalAddr() }
+func (c *sshConn) RemoteAddr() net.Addr { return c.conn.RemoteAddr() }
+
+// Deadlines aren't supported on channels. Nothing in the session uses them.
+func (c *sshConn) SetDeadline(t time.Time) error      { return nil }
+func (c *sshConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *sshConn) SetWriteDeadline(t time.Time) error { return nil }
+
+// Secure SSH is always encrypted.
+func (c *sshConn) Secure() bool {
+	return true
+}
+
+// sshKeyCommand The "sshkey" command, for managing the keys a player can log in over SSH with.
+//
+//	sshkey                 list them
+//	sshkey add <key>       register a key, as found in ~/.ssh/id_ed25519.pub
+//	sshkey remove <n>      forget the nth key in the list
+func (e *Engine) sshKeyCommand(c cmd.Command, w io.Writer) (bool, error) {
+	write := func(msg string) {
+		_, _ = w.Write([]byte(msg))
+	}
+	username := c.Actor.Player.Username
+	if username == "" {
+		write("Only players have keys.\n")
+		return true, nil
+	}
+	words := c.Words()
+	if len(words) == 0 {
+		keys, err := e.playerMgr.PlayerKeys(username)
+		if err != nil {
+			return true, err
+		}
+		if len(keys) == 0 {
+			write("You have no SSH keys. Use 'sshkey add <public key>' to add one.\n")
+			return true, nil
+		}
+		for i, k := range keys {
+			write(fmt.Sprintf("%d. %s\n", i+1, keyFingerprint(k)))
+		}
+		return true, nil
+	}
+	switch strings.ToLower(words[0]) {
+	case "add":
+		key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(strings.Join(words[1:], " ")))
+		if err != nil {
+			write("That doesn't look like a public key. Paste the contents of your .pub file.\n")
+			return true, nil
+		}
+		if err := e.playerMgr.AddPlayerKey(username, authorizedKey(key)); err != nil {
+			return true, err
+		}
+		write(fmt.Sprintf("Added %s.\n", ssh.FingerprintSHA256(key)))
+	case "remove":
+		keys, err := e.playerMgr.PlayerKeys(username)
+		if err != nil {
+			return true, err
+		}
+		n := 0
+		if len(words) > 1 {
+			n, _ = strconv.Atoi(words[1])
+		}
+		if n < 1 || n > len(keys) {
+			write("Which key? Use 'sshkey' to see the list.\n")
+			return true, nil
+		}
+		if err := e.playerMgr.RemovePlayerKey(username, keys[n-1]); err != nil {
+			return true, err
+		}
+		write(fmt.Sprintf("Removed %s.\n", keyFingerprint(keys[n-1])))
+	default:
+		write("Usage: sshkey [add <public key> | remove <number>]\n")
+	}
+	return true, nil
+}
+
+// keyFingerprint Describe a stored key the way ssh-keygen -l would.
+func keyFingerprint(stored string) string {
+	key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(stored))
+	if err != nil {
+		return "(unreadable key)"
+	}
+	return key.Type() + " " + ssh.FingerprintSHA256(key)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	entity "rob.co/textcrawl/entity"
+)
+
+func TestParsePtyRequest(t *testing.T) {
+	payload := []byte{}
+	payload = binary.BigEndian.AppendUint32(payload, uint32(len("xterm-256color")))
+	payload = append(payload, "xterm-256color"...)
+	for _, n := range []uint32{132, 40, 0, 0} {
+		payload = binary.BigEndian.AppendUint32(payload, n)
+	}
+	term, width, ok := parsePtyRequest(payload)
+	if !ok || term != "xterm-256color" || width != 132 {
+		t.Errorf("Expected xterm-256color at 132 columns, got '%s' at %d (%v)", term, width, ok)
+	}
+	if _, _, ok := parsePtyRequest(payload[:6]); ok {
+		t.Error("Expected a truncated pty-req to be rejected")
+	}
+}
+
+func TestKeyFingerprint(t *testing.T) {
+	key := "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIJdD7y3aLq454yWBdwLWbieU1ebz9/cu7/QEXn9OIeZJ"
+	got := keyFingerprint(key)
+	want := "ssh-ed25519 SHA256:"
+	if len(got) <= len(want) || got[:len(want)] != want {
+		t.Errorf("Expected a SHA256 fingerprint, got '%s'", got)
+	}
+	if keyFingerprint("nonsense") != "(unreadable key)" {
+		t.Error("Expected a bad key to be reported as unreadable")
+	}
+}
+
+// sshMeta Just enough of an SSH connection to log in with.
+type sshMeta struct {
+	ssh.ConnMetadata
+	user string
+}
+
+func (m sshMeta) User() string { return m.user }
+
+func (m sshMeta) RemoteAddr() net.Addr {
+	return &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 2222}
+}
+
+// keylessPlayerMgr Knows nobody's keys, and remembers who asked.
+type keylessPlayerMgr struct {
+	failingPlayerMgr
+	asked *[]string
+}
+
+func (pm keylessPlayerMgr) LookupPlayerKey(username string, key string) (entity.Id, error) {
+	*pm.asked = append(*pm.asked, username)
+	return "", entity.ErrBadLogin
+}
+
+func TestSSHPublicKeyLockout(t *testing.T) {
+	pub, _, _ := ed25519.GenerateKey(rand.Reader)
+	key, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatalf("Unable to make a key: %s", err)
+	}
+	pm := keylessPlayerMgr{failingPlayerMgr{failures: map[string]entity.LoginFailures{}}, &[]string{}}
+	s := NewServer(Config{LockoutFailures: 2, LockoutDuration: time.Minute}, nil, nil, pm)
+	meta := sshMeta{user: "Foo"}
+	for i := 0; i < 3; i++ {
+		if _, err := s.sshPublicKey(meta, key); err == nil {
+			t.Fatal("Expected an unknown key to be refused")
+		}
+	}
+	if len(*pm.asked) != 2 || (*pm.asked)[0] != "foo" {
+		t.Errorf("Expected foo to be looked up until locked out, got %v", *pm.asked)
+	}
+	if s.lockedOut(userSubject("foo")) == 0 {
+		t.Errorf("Expected failed keys to lock foo out, failures are %v", pm.failures)
+	}
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"io"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// Telnet command bytes. See RFC 854.
+const (
+	telnetSE   byte = 240 // end of subnegotiation
+	telnetNOP  byte = 241
+	telnetGA   byte = 249 // go ahead
+	telnetSB   byte = 250 // start of subnegotiation
+	telnetWILL byte = 251
+	telnetWONT byte = 252
+	telnetDO   byte = 253
+	telnetDONT byte = 254
+	telnetIAC  byte = 255 // interpret as command
+)
+
+// Telnet options we know about.
+const (
+	optEcho  byte = 1   // RFC 857
+	optSGA   byte = 3   // suppress go ahead, RFC 858
+	optTTYPE byte = 24  // terminal type, RFC 1091
+	optNAWS  byte = 31  // negotiate about window size, RFC 1073
+	optMCCP2 byte = 86  // mud client compression protocol v2, https://tintin.mudhalla.net/protocols/mccp/
+	optGMCP  byte = 201 // generic mud communication protocol, https://tintin.mudhalla.net/protocols/gmcp/
+)
+
+// TTYPE subnegotiation commands
+const (
+	ttypeIs   byte = 0
+	ttypeSend byte = 1
+)
+
+// MTTS clients cycle through at most three answers; don't ask forever if one misbehaves.
+const maxTTypes = 4
+
+// The MTTS bit saying the client understands ANSI colour. See https://tintin.mudhalla.net/protocols/mtts/
+const mttsANSI = 1
+
+// Terminal types which we know can show colour, even if they don't say so via MTTS
+var colorTerminals = []string{"ANSI", "VT100", "XTERM", "256COLOR", "TRUECOLOR", "MUDLET", "TINTIN", "MUSHCLIENT", "ZMUD", "CMUD"}
+
+// ttypeSupportsColor Whether a TTYPE reply indicates the client can show ANSI colour.
+func ttypeSupportsColor(ttype string) bool {
+	upper := strings.ToUpper(ttype)
+	if bits, ok := strings.CutPrefix(upper, "MTTS "); ok {
+		n, err := strconv.Atoi(bits)
+		return err == nil && n&mttsANSI != 0
+	}
+	for _, t := range colorTerminals {
+		if strings.Contains(upper, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// parser states
+type telnetState int
+
+const (
+	tsData      telnetState = iota // plain text
+	tsIAC                          // just saw IAC
+	tsNegotiate                    // saw IAC WILL/WONT/DO/DONT, want the option byte
+	tsSB                           // saw IAC SB, want the option byte
+	tsSBData                       // inside a subnegotiation
+	tsSBIAC                        // saw IAC inside a subnegotiation
+)
+
+// An optState tracks one side of an option using the "Q method" from RFC 1143,
+// which is what stops two well-meaning ends from negotiating forever.
+type optState int
+
+const (
+	optNo optState = iota
+	optYes
+	optWantYes
+	optWantNo
+)
+
+// The longest line we'll buffer before giving up on the client.
+const maxLineLength = 1000
+
+// A telnet picks apart the byte stream from a client: it answers option
+// negotiation, strips commands out of the text, and splits what's left into lines.
+type telnet struct {
+	w        io.Writer // where our negotiation goes
+	state    telnetState
+	verb     byte // the WILL/WONT/DO/DONT we're in the middle of
+	opt      byte // option being negotiated or subnegotiated
+	sb       []byte
+	line     []byte
+	sawCR    bool
+	overflow bool
+
+	// what we are doing (us) and what we've agreed the client is doing (them)
+	us   map[byte]optState
+	them map[byte]optState
+	// options we are willing to enable on each side when asked
+	supportUs   map[byte]bool
+	supportThem map[byte]bool
+
+	// called whenever an option changes state. local says whether it's our side.
+	onOption func(opt byte, local bool, enabled bool)
+	// called with the payload of each completed subnegotiation
+	onSubneg func(opt byte, data []byte)
+}
+
+func newTelnet(w io.Writer) *telnet {
+	return &telnet{
+		w:           w,
+		us:          make(map[byte]optState),
+		them:        make(map[byte]optState),
+		supportUs:   map[byte]bool{optEcho: true, optSGA: true},
+		supportThem: map[byte]bool{},
+	}
+}
+
+// Feed Process bytes read from the client. Returns any complete lines of text.
+// Lines end with "\r\n", "\r\0", or a bare "\n".
+func (t *telnet) Feed(p []byte) []string {
+	lines := []string{}
+	for _, b := range p {
+		switch t.state {
+		case tsData:
+			if b == telnetIAC {
+				t.state = tsIAC
+				continue
+			}
+			if line, ok := t.text(b); ok {
+				lines = append(lines, line)
+			}
+		case tsIAC:
+			switch b {
+			case telnetIAC:
+				// escaped 255, which is just data
+				t.state = tsData
+				if line, ok := t.text(b); ok {
+					lines = append(lines, line)
+				}
+			case telnetWILL, telnetWONT, telnetDO, telnetDONT:
+				t.verb = b
+				t.state = tsNegotiate
+			case telnetSB:
+				t.state = tsSB
+			default:
+				// NOP, GA, AYT and friends. Nothing for us to do.
+				t.state = tsData
+			}
+		case tsNegotiate:
+			t.negotiate(t.verb, b)
+			t.state = tsData
+		case tsSB:
+			t.opt = b
+			t.sb = t.sb[:0]
+			t.state = tsSBData
+		case tsSBData:
+			if b == telnetIAC {
+				t.state = tsSBIAC
+			} else {
+				t.subneg(b)
+			}
+		case tsSBIAC:
+			switch b {
+			case telnetSE:
+				if t.onSubneg != nil {
+					t.onSubneg(t.opt, t.sb)
+				}
+				t.state = tsData
+			case telnetIAC:
+				t.subneg(b)
+				t.state = tsSBData
+			default:
+				// Malformed. Abandon the subnegotiation.
+				t.state = tsData
+			}
+		}
+	}
+	return lines
+}
+
+// subneg Add a byte to the current subnegotiation, unless it's already as long as
+// we're willing to hold.
+func (t *telnet) subneg(b byte) {
+	if len(t.sb) >= maxLineLength {
+		t.overflow = true
+		return
+	}
+	t.sb = append(t.sb, b)
+}
+
+// Overflowed Whether the client has sent a line or subnegotiation longer than we're willing to hold.
+func (t *telnet) Overflowed() bool {
+	return t.overflow
+}
+
+// text Add a byte of plain text to the current line.
+// Returns the line, and true, if this byte finished it.
+func (t *telnet) text(b byte) (string, bool) {
+	if t.sawCR {
+		t.sawCR = false
+		// the second half of "\r\n" or "\r\0"
+		if b == '\n' || b == 0 {
+			return "", false
+		}
+	}
+	switch b {
+	case '\r':
+		t.sawCR = true
+		return t.takeLine(), true
+	case '\n':
+		return t.takeLine(), true
+	case 0:
+		return "", false
+	case '\b', 127:
+		// clients in character mode send us their backspaces
+		if len(t.line) > 0 {
+			t.line = t.line[:len(t.line)-1]
+		}
+		return "", false
+	}
+	if len(t.line) >= maxLineLength {
+		t.overflow = true
+		return "", false
+	}
+	t.line = append(t.line, b)
+	return "", false
+}
+
+func (t *telnet) takeLine() string {
+	line := string(t.line)
+	t.line = t.line[:0]
+	return line
+}
+
+// negotiate Respond to the client's WILL/WONT/DO/DONT for an option.
+func (t *telnet) negotiate(verb byte, opt byte) {
+	switch verb {
+	case telnetDO, telnetDONT:
+		t.us[opt] = t.respond(t.us[opt], verb == telnetDO, t.supportUs[opt], opt, true)
+	case telnetWILL, telnetWONT:
+		t.them[opt] = t.respond(t.them[opt], verb == telnetWILL, t.supportThem[opt], opt, false)
+	}
+}
+
+// respond Work out the new state of one side of an option given the client's
+// request, sending whatever reply the Q method calls for.
+func (t *telnet) respond(cur optState, enable bool, supported bool, opt byte, local bool) optState {
+	yes, no := telnetWILL, telnetWONT
+	if !local {
+		yes, no = telnetDO, telnetDONT
+	}
+	next := cur
+	if enable {
+		switch cur {
+		case optNo:
+			if supported {
+				next = optYes
+				t.send(yes, opt)
+			} else {
+				t.send(no, opt)
+			}
+		case optWantYes:
+			next = optYes
+		case optWantNo:
+			// they've agreed to something we're trying to back out of
+			next = optNo
+			t.send(no, opt)
+		}
+	} else {
+		switch cur {
+		case optYes:
+			next = optNo
+			t.send(no, opt)
+		case optWantYes, optWantNo:
+			next = optNo
+		}
+	}
+	if (cur == optYes) != (next == optYes) && t.onOption != nil {
+		t.onOption(opt, local, next == optYes)
+	}
+	return next
+}
+
+// Enable Offer to turn on one of our options (e.g. WILL ECHO).
+func (t *telnet) Enable(opt byte) {
+	if t.us[opt] == optNo || t.us[opt] == optWantNo {
+		t.us[opt] = optWantYes
+		t.send(telnetWILL, opt)
+	}
+}
+
+// Disable Turn off one of our options.
+func (t *telnet) Disable(opt byte) {
+	if t.us[opt] == optYes || t.us[opt] == optWantYes {
+		t.us[opt] = optWantNo
+		t.send(telnetWONT, opt)
+	}
+}
+
+// Request Ask the client to turn on one of its options (e.g. DO NAWS).
+func (t *telnet) Request(opt byte) {
+	if t.them[opt] == optNo || t.them[opt] == optWantNo {
+		t.them[opt] = optWantYes
+		t.send(telnetDO, opt)
+	}
+}
+
+// Enabled Whether an option is on, on our side (local) or the client's.
+func (t *telnet) Enabled(opt byte, local bool) bool {
+	if local {
+		return t.us[opt] == optYes
+	}
+	return t.them[opt] == optYes
+}
+
+// Subnegotiate Send IAC SB opt data IAC SE.
+func (t *telnet) Subnegotiate(opt byte, data []byte) {
+	t.write(subnegotiation(opt, data))
+}
+
+// subnegotiation Frame data as IAC SB opt data IAC SE, escaping any IACs in data.
+func subnegotiation(opt byte, data []byte) []byte {
+	msg := make([]byte, 0, len(data)+5)
+	msg = append(msg, telnetIAC, telnetSB, opt)
+	for _, b := range data {
+		msg = append(msg, b)
+		if b == telnetIAC {
+			msg = append(msg, telnetIAC)
+		}
+	}
+	return append(msg, telnetIAC, telnetSE)
+}
+
+func (t *telnet) send(verb byte, opt byte) {
+	t.write([]byte{telnetIAC, verb, opt})
+}
+
+func (t *telnet) write(msg []byte) {
+	if _, err := t.w.Write(msg); err != nil {
+		log.Printf("Unable to send telnet negotiation: %s", err)
+	}
+}
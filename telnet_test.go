@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestTelnetLineEndings(t *testing.T) {
+	var out bytes.Buffer
+	tn := newTelnet(&out)
+	lines := tn.Feed([]byte("look\r\ntake knife\ninv\r\x00n\r"))
+	expected := []string{"look", "take knife", "inv", "n"}
+	if len(lines) != len(expected) {
+		t.Fatalf("Expected %d lines but got %d: %q", len(expected), len(lines), lines)
+	}
+	for i, l := range expected {
+		if lines[i] != l {
+			t.Errorf("Expected line %d to be '%s' but got '%s'", i, l, lines[i])
+		}
+	}
+	// the \n completing the last \r arrives in a later read
+	lines = tn.Feed([]byte("\nsouth\n"))
+	if len(lines) != 1 || lines[0] != "south" {
+		t.Errorf("Expected just 'south' but got %q", lines)
+	}
+}
+
+func TestTelnetStripsCommands(t *testing.T) {
+	var out bytes.Buffer
+	tn := newTelnet(&out)
+	input := []byte{'l', telnetIAC, telnetNOP, 'o', telnetIAC, telnetWILL, 200, 'o',
+		telnetIAC, telnetSB, 200, 1, 2, telnetIAC, telnetIAC, telnetIAC, telnetSE, 'k', '\n'}
+	lines := tn.Feed(input)
+	if len(lines) != 1 || lines[0] != "look" {
+		t.Errorf("Expected 'look' but got %q", lines)
+	}
+	// we don't know option 200, so we should have refused it
+	if !bytes.Equal(out.Bytes(), []byte{telnetIAC, telnetDONT, 200}) {
+		t.Errorf("Expected a DONT in response to WILL but got %v", out.Bytes())
+	}
+}
+
+func TestTelnetNegotiation(t *testing.T) {
+	var out bytes.Buffer
+	tn := newTelnet(&out)
+	var subOpt byte
+	var subData []byte
+	tn.onSubneg = func(opt byte, data []byte) {
+		subOpt = opt
+		subData = append([]byte{}, data...)
+	}
+
+	// client asks us to suppress go-ahead, which we support
+	tn.Feed([]byte{telnetIAC, telnetDO, optSGA})
+	if !bytes.Equal(out.Bytes(), []byte{telnetIAC, telnetWILL, optSGA}) {
+		t.Errorf("Expected WILL SGA but got %v", out.Bytes())
+	}
+	// asking again must not start a loop
+	out.Reset()
+	tn.Feed([]byte{telnetIAC, telnetDO, optSGA})
+	if out.Len() != 0 {
+		t.Errorf("Expected no reply to a repeated DO but got %v", out.Bytes())
+	}
+
+	// we offer echo for the password prompt, client agrees
+	out.Reset()
+	tn.Enable(optEcho)
+	tn.Feed([]byte{telnetIAC, telnetDO, optEcho})
+	if !bytes.Equal(out.Bytes(), []byte{telnetIAC, telnetWILL, optEcho}) {
+		t.Errorf("Expected just our WILL ECHO but got %v", out.Bytes())
+	}
+	if !tn.Enabled(optEcho, true) {
+		t.Error("Expected echo to be enabled")
+	}
+	out.Reset()
+	tn.Disable(optEcho)
+	tn.Feed([]byte{telnetIAC, telnetDONT, optEcho})
+	if !bytes.Equal(out.Bytes(), []byte{telnetIAC, telnetWONT, optEcho}) {
+		t.Errorf("Expected just our WONT ECHO but got %v", out.Bytes())
+	}
+
+	tn.Feed([]byte{telnetIAC, telnetSB, 24, 0, 'x', telnetIAC, telnetSE})
+	if subOpt != 24 || string(subData) != "\x00x" {
+		t.Errorf("Subnegotiation not delivered correctly: %d %q", subOpt, subData)
+	}
+}
+
+func TestTelnetOverflow(t *testing.T) {
+	var out bytes.Buffer
+	tn := newTelnet(&out)
+	tn.Feed(bytes.Repeat([]byte("a"), maxLineLength+1))
+	if !tn.Overflowed() {
+		t.Error("Expected an overly long line to be flagged")
+	}
+}
+
+func TestTelnetSubnegOverflow(t *testing.T) {
+	for name, fill := range map[string][]byte{"plain": {'a'}, "escaped": {telnetIAC, telnetIAC}} {
+		tn := newTelnet(io.Discard)
+		tn.Feed([]byte{telnetIAC, telnetSB, optGMCP})
+		tn.Feed(bytes.Repeat(fill, maxLineLength+1))
+		if !tn.Overflowed() || len(tn.sb) > maxLineLength {
+			t.Errorf("Expected an overly long %s subnegotiation to be flagged, and held to %d bytes, got %d", name, maxLineLength, len(tn.sb))
+		}
+	}
+}
+
+func TestTTypeSupportsColor(t *testing.T) {
+	tests := map[string]bool{
+		"Mudlet":         true,
+		"XTERM-256COLOR": true,
+		"MTTS 137":       true,
+		"MTTS 136":       false,
+		"DUMB":           false,
+		"unknown-thing":  false,
+		"tintin++":       true,
+	}
+	for ttype, expected := range tests {
+		if ttypeSupportsColor(ttype) != expected {
+			t.Errorf("Expected ttypeSupportsColor(%q) to be %v", ttype, expected)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"log"
+	"math/big"
+	"net"
+	"time"
+)
+
+// serveTLS Accept telnet connections over TLS. Once the handshake is done
+// they're handled just like plain ones.
+func (s *Server) serveTLS() {
+	cert, err := loadCertificate(s.config.TLSCert, s.config.TLSKey)
+	if err != nil {
+		log.Printf("TLS listener unavailable: %s", err)
+		return
+	}
+	ln, err := tls.Listen("tcp", s.config.TLSAddr, &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	})
+	if err != nil {
+		log.Printf("TLS listener unavailable: %s", err)
+		return
+	}
+	log.Printf("Serving TLS on %s", s.config.TLSAddr)
+	s.accept(ln)
+}
+
+// loadCertificate Load the certificate and key from the configured files or,
+// if there aren't any, make up a self-signed pair.
+func loadCertificate(certFile string, keyFile string) (tls.Certificate, error) {
+	if certFile != "" || keyFile != "" {
+		return tls.LoadX509KeyPair(certFile, keyFile)
+	}
+	log.Printf("WARN: no TLS certificate configured. Using a self-signed one, which clients won't trust.")
+	return selfSignedCertificate()
+}
+
+// selfSignedCertificate Generate a certificate for localhost, good for a year.
+func selfSignedCertificate() (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("unable to generate key: %w", err)
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("unable to generate serial number: %w", err)
+	}
+	now := time.Now()
+	template := x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "textcrawl"},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(365 * 24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("unable to create certificate: %w", err)
+	}
+	return tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  key,
+	}, nil
+}
+
+// A secureConn is a connection that can vouch for its own encryption.
+// Wrappers around already encrypted transports implement it.
+type secureConn interface {
+	Secure() bool
+}
+
+// isSecure Whether what's sent over conn is encrypted.
+func isSecure(conn net.Conn) bool {
+	switch c := conn.(type) {
+	case *tls.Conn:
+		return true
+	case secureConn:
+		return c.Secure()
+	}
+	return false
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"testing"
+)
+
+func TestSelfSignedCertificate(t *testing.T) {
+	cert, err := selfSignedCertificate()
+	if err != nil {
+		t.Fatalf("Unable to generate certificate: %s", err)
+	}
+	parsed, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatalf("Generated certificate doesn't parse: %s", err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(parsed)
+
+	serverSide, clientSide := net.Pipe()
+	server := tls.Server(serverSide, &tls.Config{Certificates: []tls.Certificate{cert}})
+	client := tls.Client(clientSide, &tls.Config{RootCAs: pool, ServerName: "localhost"})
+	done := make(chan error)
+	go func() {
+		done <- client.Handshake()
+	}()
+	if err := server.Handshake(); err != nil {
+		t.Fatalf("Server handshake failed: %s", err)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("Client handshake failed: %s", err)
+	}
+	if !isSecure(server) {
+		t.Error("Expected a TLS connection to be secure")
+	}
+	if isSecure(serverSide) {
+		t.Error("Expected a plain connection not to be secure")
+	}
+}
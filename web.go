@@ -0,0 +1,34 @@
+package main
+
+import (
+	"embed"
+	"io/fs"
+	"log"
+	"net/http"
+
+	"golang.org/x/net/websocket"
+)
+
+//go:embed web
+var webFiles embed.FS
+
+// serveWeb Serve the browser terminal, and the WebSocket it talks to the game
+// over. Each socket is handled exactly like a telnet connection; the page
+// speaks just enough telnet to cope.
+func (s *Server) serveWeb(addr string) {
+	static, err := fs.Sub(webFiles, "web")
+	if err != nil {
+		panic(err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/", http.FileServer(http.FS(static)))
+	mux.Handle("/ws", websocket.Handler(func(ws *websocket.Conn) {
+		// telnet isn't valid UTF-8, so it can't go in text frames
+		ws.PayloadType = websocket.BinaryFrame
+		s.handleConnection(ws)
+	}))
+	log.Printf("Serving web client on %s", addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		log.Printf("Web client unavailable: %s", err)
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+// Terminal widths we'll wrap to
+const (
+	defaultWidth = 80
+	minWidth     = 20
+	maxWidth     = 250
+)
+
+const esc = 0x1b
+
+// A wrapper word-wraps a stream of output to a fixed width.
+// It remembers the column it left off at, so text written in pieces
+// (as the scripts tend to do) still wraps sensibly.
+// ANSI escape sequences are passed through without taking up any width.
+type wrapper struct {
+	width int
+	col   int
+}
+
+// wrap Return p with line breaks inserted so that no line exceeds the width.
+// Only spaces are treated as break points; existing newlines are kept and
+// a single word longer than the width is left to overflow.
+func (w *wrapper) wrap(p []byte) []byte {
+	out := make([]byte, 0, len(p)+len(p)/w.width+1)
+	word := []byte{}
+	wordLen := 0
+	// place the current word, breaking the line first if it won't fit
+	flush := func() {
+		if wordLen > 0 && w.col > 0 && w.col+wordLen > w.width {
+			out = trimTrailingSpace(out)
+			out = append(out, '\n')
+			w.col = 0
+		}
+		out = append(out, word...)
+		w.col += wordLen
+		word = word[:0]
+		wordLen = 0
+	}
+	for i := 0; i < len(p); i++ {
+		b := p[i]
+		switch {
+		case b == esc:
+			// copy the whole escape sequence into the word, uncounted
+			j := i + 1
+			if j < len(p) && p[j] == '[' {
+				j++
+				for j < len(p) && (p[j] < 0x40 || p[j] > 0x7e) {
+					j++
+				}
+			}
+			if j >= len(p) {
+				j = len(p) - 1
+			}
+			word = append(word, p[i:j+1]...)
+			i = j
+		case b == '\n' || b == '\r':
+			flush()
+			out = append(out, b)
+			w.col = 0
+		case b == ' ':
+			flush()
+			if w.col < w.width {
+				out = append(out, b)
+				w.col++
+			}
+		default:
+			word = append(word, b)
+			// only count the first byte of each UTF-8 character
+			if b&0xc0 != 0x80 {
+				wordLen++
+			}
+		}
+	}
+	flush()
+	return out
+}
+
+// trimTrailingSpace Drop spaces we've already emitted at the end of a line we're about to break.
+// This only looks at what's in this write; spaces sent earlier are gone.
+func trimTrailingSpace(out []byte) []byte {
+	for len(out) > 0 && out[len(out)-1] == ' ' {
+		out = out[:len(out)-1]
+	}
+	return out
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestWrap(t *testing.T) {
+	w := wrapper{width: 20}
+	out := string(w.wrap([]byte("This is an empty room. It only exists as a sample.\n")))
+	expected := "This is an empty\nroom. It only exists\nas a sample.\n"
+	if out != expected {
+		t.Errorf("Expected %q but got %q", expected, out)
+	}
+	if w.col != 0 {
+		t.Errorf("Expected to be at column 0 after a newline but was at %d", w.col)
+	}
+}
+
+func TestWrapAcrossWrites(t *testing.T) {
+	w := wrapper{width: 12}
+	out := string(w.wrap([]byte("Exits: ")))
+	out += string(w.wrap([]byte("north ")))
+	out += string(w.wrap([]byte("south ")))
+	expected := "Exits: north\nsouth "
+	if out != expected {
+		t.Errorf("Expected %q but got %q", expected, out)
+	}
+}
+
+func TestWrapIgnoresEscapes(t *testing.T) {
+	w := wrapper{width: 10}
+	in := "\x1b[31mred\x1b[0m \x1b[1;32mgreen\x1b[0m"
+	out := string(w.wrap([]byte(in)))
+	if out != in {
+		t.Errorf("Escape sequences should not count toward width, got %q", out)
+	}
+	w = wrapper{width: 10}
+	out = string(w.wrap([]byte("héllo wörld")))
+	if out != "héllo\nwörld" {
+		t.Errorf("Expected multi-byte characters to count once, got %q", out)
+	}
+}